@@ -0,0 +1,102 @@
+package main
+
+import (
+	"fmt"
+	"maps"
+	"os"
+	"slices"
+
+	"github.com/alxarno/tinytune/internal"
+	"github.com/urfave/cli/v2"
+)
+
+const hiddenValue = "<hidden>"
+
+func configCommand() *cli.Command {
+	return &cli.Command{
+		Name:  "config",
+		Usage: "configuration of the server",
+		Subcommands: []*cli.Command{
+			{
+				Name: "print",
+				Usage: "print the effective configuration merged from the flags, environment variables, config file and defaults, " +
+					"in the format of the config file",
+				ArgsUsage: "[data folder path]",
+				Action:    configPrint,
+			},
+		},
+	}
+}
+
+// configOptions returns names of the global options, which can be set in the config file.
+func configOptions(flags []cli.Flag) []string {
+	options := []string{}
+
+	for _, flag := range flags {
+		name := flag.Names()[0]
+		if name == "config" || name == cli.HelpFlag.Names()[0] || name == cli.VersionFlag.Names()[0] {
+			continue
+		}
+
+		options = append(options, name)
+	}
+
+	return options
+}
+
+// loadConfigFile sets the global options from the config file,
+// unless they are set by the flags or environment variables.
+func loadConfigFile(cCtx *cli.Context) error {
+	path := cCtx.String("config")
+	if path == "" {
+		return nil
+	}
+
+	values, err := internal.ReadConfigFile(path, configOptions(cCtx.App.Flags))
+	if err != nil {
+		return cli.Exit(err.Error(), ExitConfigFile)
+	}
+
+	for _, name := range slices.Sorted(maps.Keys(values)) {
+		if cCtx.IsSet(name) {
+			continue
+		}
+
+		for _, value := range values[name] {
+			if err := cCtx.Set(name, value); err != nil {
+				return cli.Exit(fmt.Sprintf("%v (%s): %s: %v", internal.ErrConfigFileInvalid, path, name, err), ExitConfigFile)
+			}
+		}
+	}
+
+	return nil
+}
+
+func configPrint(cCtx *cli.Context) error {
+	global := globalContext(cCtx)
+	options := configOptions(global.App.Flags)
+	values := make(map[string]any, len(options))
+
+	for _, flag := range global.App.Flags {
+		name := flag.Names()[0]
+
+		switch flag.(type) {
+		case *cli.StringSliceFlag:
+			values[name] = global.StringSlice(name)
+		default:
+			values[name] = global.Value(name)
+		}
+	}
+
+	values["dir"] = dataDirArg(cCtx)
+
+	if values["admin-token"] != "" {
+		values["admin-token"] = hiddenValue
+	}
+
+	if err := internal.WriteConfig(os.Stdout, options, values); err != nil {
+		return cli.Exit(fmt.Sprintf("Failed to print the config: %v", err), ExitFailure)
+	}
+
+	return nil
+}
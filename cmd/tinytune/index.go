@@ -0,0 +1,224 @@
+package main
+
+import (
+	"fmt"
+	"log/slog"
+	"os"
+	"time"
+
+	"github.com/alxarno/tinytune/internal"
+	"github.com/alxarno/tinytune/pkg/bytesutil"
+	"github.com/alxarno/tinytune/pkg/index"
+	"github.com/alxarno/tinytune/pkg/logging"
+	"github.com/urfave/cli/v2"
+)
+
+func indexCommand() *cli.Command {
+	return &cli.Command{
+		Name:  "index",
+		Usage: "maintenance of the index file",
+		Subcommands: []*cli.Command{
+			{
+				Name:      "verify",
+				Usage:     "check the index file integrity and report corrupted entries",
+				ArgsUsage: "[data folder path]",
+				Flags: []cli.Flag{
+					&cli.BoolFlag{
+						Name:  "drop",
+						Usage: "drop corrupted previews, so they are produced again at the next start",
+					},
+					indexPathFlag(),
+				},
+				Action: indexVerify,
+			},
+			{
+				Name:      "compact",
+				Usage:     "free the space taken by thumbnails of removed files",
+				ArgsUsage: "[data folder path]",
+				Flags:     []cli.Flag{indexPathFlag()},
+				Action:    indexCompact,
+			},
+			{
+				Name:      "failed",
+				Usage:     "list files, which failed to be processed, they are retried at later starts or with --retry-failed",
+				ArgsUsage: "[data folder path]",
+				Flags:     []cli.Flag{indexPathFlag()},
+				Action:    indexFailed,
+			},
+		},
+	}
+}
+
+func indexPathFlag() cli.Flag {
+	return &cli.StringFlag{
+		Name:  "index-path",
+		Usage: "location of the index file, by default the global option is used or it's found the same way as at the server start",
+	}
+}
+
+// globalContext returns the context of the application, which has values of the global options.
+func globalContext(cCtx *cli.Context) *cli.Context {
+	global := cCtx
+
+	// the application context is the farthest one, which has the application
+	for _, parent := range cCtx.Lineage() {
+		if parent.App != nil {
+			global = parent
+		}
+	}
+
+	return global
+}
+
+// globalOption returns the value of the global option, it can be set by the flag, environment variable or config file.
+func globalOption(cCtx *cli.Context, name string) string {
+	return globalContext(cCtx).String(name)
+}
+
+func dataDirArg(cCtx *cli.Context) string {
+	if cCtx.Args().Len() != 0 {
+		return cCtx.Args().First()
+	}
+
+	return globalOption(cCtx, "dir")
+}
+
+func indexFilePathArg(cCtx *cli.Context) string {
+	path := cCtx.String("index-path")
+	if path == "" {
+		path = globalOption(cCtx, "index-path")
+	}
+
+	return internal.IndexFilePath(dataDirArg(cCtx), path)
+}
+
+func indexVerify(cCtx *cli.Context) error {
+	slog.SetDefault(logging.Get())
+
+	indexFilePath := indexFilePathArg(cCtx)
+
+	indexFile, err := os.Open(indexFilePath)
+	if err != nil {
+		return cli.Exit(fmt.Sprintf("Failed to open the index file: %v", err), ExitIndexFile)
+	}
+	defer indexFile.Close()
+
+	if err := index.CheckFile(indexFile); err != nil {
+		return cli.Exit(fmt.Sprintf("The index file is damaged, the backup will be used at the next start: %v", err), ExitIndexFile)
+	}
+
+	idx, err := index.NewIndex(cCtx.Context, indexFile, index.WithRoot(dataDirArg(cCtx)), index.WithLazyPreviews())
+	if err != nil {
+		return cli.Exit(fmt.Sprintf("Failed to read the index file: %v", err), ExitIndexFile)
+	}
+	defer idx.Close()
+
+	corrupted := idx.Verify()
+	totalFiles, previewFilesCount, _ := idx.FilesWithPreviewStat()
+
+	for _, m := range corrupted {
+		slog.Warn("Corrupted preview", slog.String("path", string(m.RelativePath)), slog.String("id", string(m.ID)))
+	}
+
+	slog.Info(
+		"Verified",
+		slog.Int("total files", totalFiles),
+		slog.Int("files with preview", previewFilesCount),
+		slog.Int("corrupted previews", len(corrupted)),
+	)
+
+	if len(corrupted) == 0 {
+		return nil
+	}
+
+	if !cCtx.Bool("drop") {
+		return cli.Exit("Corrupted previews found, use --drop to remove them", ExitFailure)
+	}
+
+	idx.DropPreviews(corrupted)
+
+	count, err := idx.Save(indexFilePath)
+	if err != nil {
+		return cli.Exit(fmt.Sprintf("Failed to save the index file: %v", err), ExitIndexFile)
+	}
+
+	slog.Info(
+		"Corrupted previews dropped, they will be produced again at the next start",
+		slog.String("size", bytesutil.PrettyByteSize(count)),
+	)
+
+	return nil
+}
+
+func indexCompact(cCtx *cli.Context) error {
+	slog.SetDefault(logging.Get())
+
+	indexFilePath := indexFilePathArg(cCtx)
+
+	indexFile, err := os.Open(indexFilePath)
+	if err != nil {
+		return cli.Exit(fmt.Sprintf("Failed to open the index file: %v", err), ExitIndexFile)
+	}
+	defer indexFile.Close()
+
+	if err := index.CheckFile(indexFile); err != nil {
+		return cli.Exit(fmt.Sprintf("The index file is damaged, the backup will be used at the next start: %v", err), ExitIndexFile)
+	}
+
+	idx, err := index.NewIndex(cCtx.Context, indexFile, index.WithRoot(dataDirArg(cCtx)), index.WithLazyPreviews())
+	if err != nil {
+		return cli.Exit(fmt.Sprintf("Failed to read the index file: %v", err), ExitIndexFile)
+	}
+	defer idx.Close()
+
+	freed, count, err := idx.Compact(indexFilePath)
+	if err != nil {
+		return cli.Exit(fmt.Sprintf("Failed to compact the index file, check it with 'index verify': %v", err), ExitIndexFile)
+	}
+
+	if freed == 0 {
+		slog.Info("The index file is already compact")
+
+		return nil
+	}
+
+	slog.Info(
+		"Compacted",
+		slog.String("freed", bytesutil.PrettyByteSize(freed)),
+		slog.String("size", bytesutil.PrettyByteSize(count)),
+	)
+
+	return nil
+}
+
+func indexFailed(cCtx *cli.Context) error {
+	slog.SetDefault(logging.Get())
+
+	indexFile, err := os.Open(indexFilePathArg(cCtx))
+	if err != nil {
+		return cli.Exit(fmt.Sprintf("Failed to open the index file: %v", err), ExitIndexFile)
+	}
+	defer indexFile.Close()
+
+	idx, err := index.NewIndex(cCtx.Context, indexFile, index.WithRoot(dataDirArg(cCtx)), index.WithLazyPreviews())
+	if err != nil {
+		return cli.Exit(fmt.Sprintf("Failed to read the index file: %v", err), ExitIndexFile)
+	}
+
+	failed := idx.Failed()
+
+	for _, m := range failed {
+		slog.Warn(
+			"Failed",
+			slog.String("path", string(m.RelativePath)),
+			slog.Int("attempts", m.Failure.Attempts),
+			slog.String("last attempt", m.Failure.Time.Format(time.DateTime)),
+			slog.String("next attempt", m.Failure.RetryAt().Format(time.DateTime)),
+			slog.String("reason", m.Failure.Reason),
+		)
+	}
+
+	slog.Info("Files failed to be processed", slog.Int("count", len(failed)))
+
+	return nil
+}
@@ -2,13 +2,13 @@ package main
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"io"
-	"io/fs"
 	"log/slog"
 	"os"
 	"os/signal"
-	"path/filepath"
+	"strings"
 	"syscall"
 
 	"github.com/alxarno/tinytune/internal"
@@ -16,6 +16,7 @@ import (
 	"github.com/alxarno/tinytune/pkg/index"
 	"github.com/alxarno/tinytune/pkg/logging"
 	"github.com/alxarno/tinytune/pkg/preview"
+	"github.com/schollz/progressbar/v3"
 	"github.com/urfave/cli/v2"
 )
 
@@ -32,9 +33,19 @@ var (
 	Mode           = DebugMode
 )
 
+// exit codes, so scripts and service managers can tell failures apart.
+const (
+	ExitFailure       = 1
+	ExitUsage         = 2
+	ExitInvalidConfig = 3
+	ExitConfigFile    = 4
+	ExitIndexFile     = 5
+	ExitDataFolder    = 6
+	ExitMediaTools    = 7
+)
+
 //nolint:lll
 const (
-	IndexFileName         = "index.tinytune"
 	CommonCLICategory     = "Common:"
 	ProcessingCLICategory = `Processing:
     In order for the web interface to be able to view thumbnails of media files, as well as play them, the program needs to process them and get meta information.
@@ -72,6 +83,8 @@ func main() {
 		Suggest:     true,
 		HideVersion: false,
 		UsageText:   "tinytune [data folder path] [global options]",
+		// patterns contain commas, e.g. in regular expression quantifiers
+		DisableSliceFlagSeparator: true,
 		Authors: []*cli.Author{
 			{
 				Name:  "alxarno",
@@ -79,17 +92,92 @@ func main() {
 			},
 		},
 		Flags: []cli.Flag{
+			&cli.StringFlag{
+				Name:      "config",
+				EnvVars:   []string{"TINYTUNE_CONFIG"},
+				Usage:     "YAML file with values of the options, keys are their names, e.g. 'port: 8080', repeatable options take lists. Options set by flags and environment variables ($TINYTUNE_<NAME>, e.g. $TINYTUNE_MAX_FILE_SIZE) take precedence over the file",
+				TakesFile: true,
+				Category:  CommonCLICategory,
+			},
+			&cli.StringFlag{
+				Name:        "dir",
+				EnvVars:     []string{"TINYTUNE_DIR"},
+				Value:       rawConfig.Dir,
+				DefaultText: "the working directory",
+				Usage:       "the data folder path, the argument takes precedence over it",
+				Destination: &rawConfig.Dir,
+				Category:    CommonCLICategory,
+			},
 			&cli.BoolFlag{
 				Name:    "index-save",
+				EnvVars: []string{"TINYTUNE_INDEX_SAVE"},
 				Value:   rawConfig.IndexFileSave,
 				Aliases: []string{"is"},
-				Usage: `the program creates a special file in the working directory “index.tinytune”. This file stores all necessary data obtained during indexing of the working directory.
+				Usage: `the program creates a special file “index.tinytune” at '--index-path' (by default in the user's cache directory, unless the working directory has one). This file stores all necessary data obtained during indexing of the data folder.
+                New thumbnails are appended to it. When it is written anew, e.g. after an upgrade, the previous version is kept as “index.tinytune.bak” and is used if the main one gets damaged. The backup isn't refreshed by appends, so it lacks the thumbnails produced since the last full write.
                 You can turn off its saving, but at the next startup, the application will start processing again`,
 				Destination: &rawConfig.IndexFileSave,
 				Category:    CommonCLICategory,
 			},
+			&cli.StringFlag{
+				Name:        "index-path",
+				EnvVars:     []string{"TINYTUNE_INDEX_PATH"},
+				Value:       rawConfig.IndexPath,
+				Usage:       "location of the index file. By default, the “index.tinytune” existing in the working directory is used, otherwise the one in the user's cache directory ($XDG_CACHE_HOME/tinytune), so the working directory can be read-only",
+				Destination: &rawConfig.IndexPath,
+				Category:    CommonCLICategory,
+			},
+			&cli.StringFlag{
+				Name:        "checkpoint-interval",
+				EnvVars:     []string{"TINYTUNE_CHECKPOINT_INTERVAL"},
+				Value:       rawConfig.CheckpointInterval,
+				Usage:       "while files are processed, the index file is saved this often, so an interrupted processing continues from the saved state. Examples of values: 5m, 120s, 0 (disabled)",
+				Destination: &rawConfig.CheckpointInterval,
+				Category:    CommonCLICategory,
+			},
+			&cli.IntFlag{
+				Name:        "checkpoint-previews",
+				EnvVars:     []string{"TINYTUNE_CHECKPOINT_PREVIEWS"},
+				Value:       rawConfig.CheckpointPreviews,
+				Usage:       "the index file is also saved each time this number of new thumbnails has been produced (0 - disabled)",
+				Destination: &rawConfig.CheckpointPreviews,
+				Category:    CommonCLICategory,
+			},
+			&cli.BoolFlag{
+				Name:        "content-identity",
+				EnvVars:     []string{"TINYTUNE_CONTENT_IDENTITY"},
+				Value:       rawConfig.ContentIdentity,
+				Usage:       "identify files by size and partial content instead of path and modification time, so moved, renamed and touched files keep their links and thumbnails (files are read partly at the first start)",
+				Destination: &rawConfig.ContentIdentity,
+				Category:    CommonCLICategory,
+			},
+			&cli.BoolFlag{
+				Name:        "watch",
+				EnvVars:     []string{"TINYTUNE_WATCH"},
+				Value:       rawConfig.Watch,
+				Usage:       "watch the data folder while the server runs, so added, changed and removed files appear in the interface without restart. Changes made over network mounts (NFS, SMB) aren't seen, they are picked up by rescans (SIGHUP, /admin/rescan)",
+				Destination: &rawConfig.Watch,
+				Category:    CommonCLICategory,
+			},
+			&cli.BoolFlag{
+				Name:        "full-rescan",
+				EnvVars:     []string{"TINYTUNE_FULL_RESCAN"},
+				Value:       rawConfig.FullRescan,
+				Usage:       "read all folders of the data folder at the start. Otherwise folders, which modification time hasn't changed since the last indexing, are taken from the index file, so files changed in place (without being renamed or replaced) may be missed",
+				Destination: &rawConfig.FullRescan,
+				Category:    CommonCLICategory,
+			},
+			&cli.BoolFlag{
+				Name:        "follow-symlinks",
+				EnvVars:     []string{"TINYTUNE_FOLLOW_SYMLINKS"},
+				Value:       rawConfig.FollowSymlinks,
+				Usage:       "descend into linked folders and process targets of linked files, a file reached by several links is processed once. Loops of links are skipped",
+				Destination: &rawConfig.FollowSymlinks,
+				Category:    CommonCLICategory,
+			},
 			&cli.BoolFlag{
 				Name:        "video",
+				EnvVars:     []string{"TINYTUNE_VIDEO"},
 				Value:       rawConfig.Video,
 				Usage:       "allows the server to process videos, for playing them in browser and show thumbnails",
 				Destination: &rawConfig.Video,
@@ -97,6 +185,7 @@ func main() {
 			},
 			&cli.StringFlag{
 				Name:        "video-processing-accel",
+				EnvVars:     []string{"TINYTUNE_VIDEO_PROCESSING_ACCEL"},
 				Value:       string(preview.Auto),
 				Usage:       "processing type for videos: 'auto', 'hardware', 'software'",
 				Destination: &rawConfig.VideoProcessingAccel,
@@ -104,6 +193,7 @@ func main() {
 			},
 			&cli.BoolFlag{
 				Name:        "image",
+				EnvVars:     []string{"TINYTUNE_IMAGE"},
 				Value:       rawConfig.Images,
 				Usage:       "allows the server to process images, to show thumbnails",
 				Destination: &rawConfig.Images,
@@ -111,6 +201,7 @@ func main() {
 			},
 			&cli.Int64Flag{
 				Name:        "max-images",
+				EnvVars:     []string{"TINYTUNE_MAX_IMAGES"},
 				Value:       rawConfig.MaxImages,
 				Usage:       "limits the number of image files to be processed (thumbnails producing)",
 				Destination: &rawConfig.MaxImages,
@@ -118,6 +209,7 @@ func main() {
 			},
 			&cli.Int64Flag{
 				Name:        "max-videos",
+				EnvVars:     []string{"TINYTUNE_MAX_VIDEOS"},
 				Value:       rawConfig.MaxVideos,
 				Usage:       "limits the number of video files to be processed (thumbnails producing)",
 				Destination: &rawConfig.MaxVideos,
@@ -125,74 +217,135 @@ func main() {
 			},
 			&cli.IntFlag{
 				Name:        "parallel",
+				EnvVars:     []string{"TINYTUNE_PARALLEL"},
 				Value:       rawConfig.Parallel,
 				Usage:       "simultaneous image/video processing (!large values increase RAM consumption!)",
 				Destination: &rawConfig.Parallel,
 				Category:    ProcessingCLICategory,
 			},
-			&cli.StringFlag{
-				Name:  "includes",
-				Value: rawConfig.Includes,
-				Usage: `this parameter will help to include back into processing files that were disabled by the '--exclude' parameter. Regular expressions are also used here, separated by commas.
+			&cli.StringSliceFlag{
+				Name:    "includes",
+				EnvVars: []string{"TINYTUNE_INCLUDES"},
+				Usage: `this parameter will help to include back into processing files that were disabled by the '--excludes' parameter. Patterns are the same as for '--excludes', repeat the flag to specify several of them.
                 Example: 'video/sample[.]mp4$' -> will return the sample.mp4 file, which is located in the video folder (no matter at what level the folder is located) to processing`,
-				Destination: &rawConfig.Includes,
-				Category:    ProcessingCLICategory,
+				Category: ProcessingCLICategory,
 			},
-			&cli.StringFlag{
-				Name:  "excludes",
-				Value: rawConfig.Excludes,
-				Usage: `if you want to more finely restrict the files to be processed, use this option. You can specify multiple regular expressions, separated by commas.
-                Files that fall under one of these expressions will not be processed (but you will still see them in the interface).
-                Example: '\\.(mp4|avi)$' -> turn off processing for all files with .mp4 and .avi extensions`,
-				Destination: &rawConfig.Excludes,
-				Category:    ProcessingCLICategory,
+			&cli.StringSliceFlag{
+				Name:    "excludes",
+				EnvVars: []string{"TINYTUNE_EXCLUDES"},
+				Usage: `if you want to more finely restrict the files to be processed, use this option. Patterns are regular expressions ('re:' prefix is optional) or globs ('glob:' prefix, a glob without '/' matches the file name in any folder, '**' matches any folders), they are matched case-insensitively against paths relative to the data folder. Repeat the flag to specify several patterns, values (including $TINYTUNE_* ones) aren't split by commas anymore.
+                Files that fall under one of these patterns will not be processed (but you will still see them in the interface). To hide files from the interface, list them in '.tinytuneignore' files (gitignore syntax) in any folder, dotfiles, Thumbs.db and @eaDir are hidden by default.
+                Examples: '\\.(mp4|avi)$' -> turn off processing for all files with .mp4 and .avi extensions, 'glob:raw/**' -> for all files in the raw folder of the data folder`,
+				Category: ProcessingCLICategory,
 			},
 			&cli.StringFlag{
 				Name:        "max-file-size",
-				Usage:       "this option restricts files from being processed if their size exceeds a certain value. Values can be specified as follows: 25KB, 10mb, 1GB, 2gb",
+				EnvVars:     []string{"TINYTUNE_MAX_FILE_SIZE"},
+				Usage:       "this option restricts files from being processed if their size exceeds a certain value. Values can be specified as follows: 25KB, 10mb, 1GB, 1.5gb",
 				Value:       rawConfig.MaxFileSize,
 				Destination: &rawConfig.MaxFileSize,
 				Category:    ProcessingCLICategory,
 			},
 			&cli.StringFlag{
 				Name:        "timeout",
+				EnvVars:     []string{"TINYTUNE_TIMEOUT"},
 				Usage:       "sometimes some files take too long to process, here you can specify a time limit in which they should be processed. Examples of values: 5m, 120s",
 				Value:       rawConfig.MediaTimeout,
 				Destination: &rawConfig.MediaTimeout,
 				Category:    ProcessingCLICategory,
 			},
-			&cli.StringFlag{
-				Name: "streaming",
+			&cli.BoolFlag{
+				Name:        "retry-failed",
+				EnvVars:     []string{"TINYTUNE_RETRY_FAILED"},
+				Value:       rawConfig.RetryFailed,
+				Usage:       "process again files, which failed to be processed before. Otherwise they are retried after a delay, which doubles with each attempt (from 1 hour up to 30 days)",
+				Destination: &rawConfig.RetryFailed,
+				Category:    ProcessingCLICategory,
+			},
+			&cli.StringSliceFlag{
+				Name:    "streaming",
+				EnvVars: []string{"TINYTUNE_STREAMING"},
 				Usage: `some files cannot be played in the browser, such as flv and avi. Therefore, such files need to be transcoded.
-                Specify here, using regular expressions, which files you would like to transcode on the fly for browser viewing`,
-				Value:       rawConfig.Streaming,
-				Destination: &rawConfig.Streaming,
-				Category:    ServerCLICategory,
+                Specify here, using patterns like for '--excludes', which files you would like to transcode on the fly for browser viewing`,
+				Value:    cli.NewStringSlice(rawConfig.Streaming...),
+				Category: ServerCLICategory,
 			},
 			&cli.IntFlag{
 				Name:        "port",
+				EnvVars:     []string{"TINYTUNE_PORT"},
 				Usage:       "http server port",
 				Value:       rawConfig.Port,
 				Destination: &rawConfig.Port,
 				Aliases:     []string{"p"},
 				Category:    ServerCLICategory,
 			},
+			&cli.StringFlag{
+				Name:        "admin-token",
+				Usage:       "enables the admin endpoints /admin/indexing[/pause|/resume|/cancel|/parallel?value=N] and /admin/rescan, requests have to carry the 'Authorization: Bearer <token>' header. Processing is also paused and resumed by SIGUSR1 and SIGUSR2 signals, the data folder is rescanned by SIGHUP",
+				EnvVars:     []string{"TINYTUNE_ADMIN_TOKEN"},
+				Destination: &rawConfig.AdminToken,
+				Category:    ServerCLICategory,
+			},
+		},
+		Commands: []*cli.Command{
+			indexCommand(),
+			configCommand(),
 		},
+		Before: loadConfigFile,
 		Action: func(ctx *cli.Context) error {
 			if ctx.Args().Len() != 0 {
 				rawConfig.Dir = ctx.Args().Get(ctx.Args().Len() - 1)
 			}
-			config := internal.NewConfig(rawConfig)
-			start(config)
 
-			return nil
+			rawConfig.Includes = ctx.StringSlice("includes")
+			rawConfig.Excludes = ctx.StringSlice("excludes")
+			rawConfig.Streaming = ctx.StringSlice("streaming")
+
+			config, err := internal.NewConfig(rawConfig)
+			if err != nil {
+				return cli.Exit(invalidConfigMessage(err), ExitInvalidConfig)
+			}
+
+			return start(config)
 		},
 	}
 
-	internal.PanicError(app.Run(os.Args))
+	// failures are reported by exit errors, the rest are mostly wrong flags, the usage is printed before them
+	if err := app.Run(os.Args); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(ExitUsage)
+	}
+}
+
+// invalidConfigMessage lists the errors of the options one per line.
+func invalidConfigMessage(err error) string {
+	return "Invalid configuration:\n  " + strings.ReplaceAll(err.Error(), "\n", "\n  ")
 }
 
-func start(config internal.Config) {
+// logScan reports the scanned files, which are skipped or excluded from media processing.
+func logScan(files []index.FileMeta, scanReports *internal.ScanReports, config internal.Config) {
+	if skipped := scanReports.Last().Skipped; len(skipped) != 0 {
+		slog.Warn(
+			"Some entries of the data folder couldn't be read, they are skipped, the report is available at /scan-report",
+			slog.Int("count", len(skipped)),
+		)
+	}
+
+	slog.Info("Indexing started")
+
+	excludedFromPreview := internal.GetExcludedFiles(
+		files,
+		config.Process.Includes,
+		config.Process.Excludes,
+	)
+
+	if len(excludedFromPreview) != 0 {
+		slog.Info(fmt.Sprintf("Got %v excluded files from media processing", len(excludedFromPreview)))
+	}
+}
+
+//nolint:cyclop,funlen
+func start(config internal.Config) error {
 	slog.SetDefault(logging.Get())
 
 	ctx := gracefulShutdownCtx()
@@ -200,115 +353,287 @@ func start(config internal.Config) {
 	slog.Info("TinyTune", slog.String("version", Version))
 	config.Print()
 
-	indexFilePath := filepath.Join(config.Dir, IndexFileName)
+	indexFilePath := config.IndexPath
+	indexFilePaths := index.FilePaths(indexFilePath)
 
-	files, err := internal.NewCrawlerOS(config.Dir).Scan(indexFilePath)
-	internal.PanicError(err)
+	indexFile, err := index.Open(indexFilePath)
+	if err != nil {
+		return cli.Exit(fmt.Sprintf("Failed to open the index file: %v", err), ExitIndexFile)
+	}
 
-	indexFileRights := 0755
+	indexFileReader := io.Reader(nil)
+	scanReports := &internal.ScanReports{}
+	crawlerOptions := []internal.CrawlerOSOption{
+		internal.WithCrawlerReports(scanReports),
+		internal.WithFollowSymlinks(config.FollowSymlinks),
+	}
 
-	indexFile, err := os.OpenFile(indexFilePath, os.O_RDWR|os.O_CREATE, fs.FileMode(indexFileRights))
-	internal.PanicError(err)
-	defer indexFile.Close()
+	if indexFile != nil {
+		defer indexFile.Close()
 
-	indexFileReader := io.Reader(indexFile)
-	fileInfo, err := indexFile.Stat()
-	internal.PanicError(err)
+		fileInfo, err := indexFile.Stat()
+		if err != nil {
+			return cli.Exit(fmt.Sprintf("Failed to read the index file: %v", err), ExitIndexFile)
+		}
 
-	if fileInfo.Size() != 0 {
 		slog.Info(
 			"Found index file",
 			slog.String("size", bytesutil.PrettyByteSize(fileInfo.Size())),
-			slog.String("path", indexFilePath),
+			slog.String("path", indexFile.Name()),
 		)
-	} else {
-		slog.Info("Created new index file", slog.String("path", indexFilePath))
 
-		indexFileReader = nil
+		indexFileReader = indexFile
+	} else {
+		slog.Info("Index file will be created", slog.String("path", indexFilePath))
 	}
 
-	slog.Info("Indexing started")
-
-	excludedFromPreview := internal.GetExcludedFiles(
-		files,
-		config.Process.Includes,
-		config.Process.Excludes,
-	)
-
-	if len(excludedFromPreview) != 0 {
-		slog.Info(fmt.Sprintf("Got %v excluded files from media processing", len(excludedFromPreview)))
-	}
+	dirConfigs := internal.NewDirConfigs(config.Dir, internal.DirSettings{
+		Streaming:   config.Streaming,
+		MaxFileSize: config.Process.MaxFileSize,
+		Image:       config.Process.Image.Process,
+		Video:       config.Process.Video.Process,
+		Excludes:    config.Process.Excludes,
+		Includes:    config.Process.Includes,
+	})
 
 	previewer, err := preview.NewPreviewer(
 		preview.WithImage(config.Process.Image.Process),
 		preview.WithVideo(config.Process.Video.Process),
-		preview.WithExcludedFiles(excludedFromPreview),
 		preview.WithMaxImages(config.Process.Image.MaxItems),
 		preview.WithMaxVideos(config.Process.Video.MaxItems),
 		preview.WithMaxFileSize(config.Process.MaxFileSize),
 		preview.WithTimeout(config.Process.Timeout),
 		preview.WithVideoAccel(config.Process.VideoAccel),
+		preview.WithSettings(dirConfigs.Process),
 	)
-	internal.PanicError(err)
+	if err != nil {
+		return cli.Exit(fmt.Sprintf("Failed to start media processing, make sure FFmpeg is available: %v", err), ExitMediaTools)
+	}
 
-	indexProgressBar := internal.Bar(len(files), "Processing ...")
+	files := []index.FileMeta{}
+	indexProgressBar := (*progressbar.ProgressBar)(nil)
 	progressBarAdd := func() {
-		internal.PanicError(indexProgressBar.Add(1))
+		if err := indexProgressBar.Add(1); err != nil {
+			slog.Debug("Failed to update the progress bar", slog.String("error", err.Error()))
+		}
 	}
 
-	indexNewFiles := 0
-	index, err := index.NewIndex(
-		ctx,
-		indexFileReader,
-		index.WithFiles(files),
+	// the files are listed once the index file is decoded,
+	// so folders unchanged since the last indexing are taken from it without reading the file again
+	scan := func(known *index.Index) ([]index.FileMeta, error) {
+		if !config.FullRescan {
+			crawlerOptions = append(crawlerOptions, internal.WithKnownTree(known))
+		}
+
+		scanned, err := internal.NewCrawlerOS(config.Dir, crawlerOptions...).Scan(indexFilePaths...)
+		if err != nil {
+			return nil, err //nolint:wrapcheck
+		}
+
+		files = scanned
+		logScan(files, scanReports, config)
+		indexProgressBar = internal.Bar(len(files), "Processing ...")
+
+		return files, nil
+	}
+
+	indexOptions := []index.Option{
+		index.WithRoot(config.Dir),
+		index.WithScan(scan),
 		index.WithPreview(previewer),
 		index.WithWorkers(config.Process.Parallel),
 		index.WithProgress(progressBarAdd),
 		index.WithRemovedFilesCleaning(),
-	)
-	internal.PanicError(err)
+		index.WithLazyPreviews(),
+	}
 
-	if indexNewFiles != 0 {
-		slog.Info("New files found", slog.Int("count", indexNewFiles))
+	if config.ContentIdentity {
+		indexOptions = append(indexOptions, index.WithContentIdentity())
 	}
 
-	totalFiles, previewFilesCount, previewsSize := index.FilesWithPreviewStat()
+	if config.Process.RetryFailed {
+		indexOptions = append(indexOptions, index.WithRetryFailed())
+	}
 
-	slog.Info("Indexing done")
-	slog.Info(
-		"Stat",
-		slog.Int("total files", totalFiles),
-		slog.Int("files with preview", previewFilesCount),
-		slog.String("total preview data size", bytesutil.PrettyByteSize(previewsSize)),
-	)
+	if config.IndexFileSave {
+		indexOptions = append(indexOptions, index.WithCheckpoint(
+			config.Checkpoint.Interval,
+			config.Checkpoint.Previews,
+			func(idx *index.Index) error {
+				_, err := idx.Save(indexFilePath)
 
-	if index.OutDated() && config.IndexFileSave {
-		err = indexFile.Truncate(0)
-		internal.PanicError(err)
-		_, err = indexFile.Seek(0, 0)
-		internal.PanicError(err)
-		count, err := index.Encode(indexFile)
-		internal.PanicError(err)
-		slog.Info("Index file saved", slog.String("size", bytesutil.PrettyByteSize(count)))
+				return err //nolint:wrapcheck
+			},
+		))
 	}
 
-	streamingFiles := internal.GetIncludedFiles(files, config.Streaming)
-	if len(streamingFiles) != 0 {
-		slog.Info(fmt.Sprintf("Got %v files for streaming", len(streamingFiles)))
+	indexOptions = append(indexOptions, index.WithBackground())
+
+	idx, err := index.NewIndex(ctx, indexFileReader, indexOptions...)
+	if errors.Is(err, index.ErrScan) {
+		return cli.Exit(fmt.Sprintf("Failed to read the data folder: %v", err), ExitDataFolder)
 	}
 
+	if err != nil {
+		return cli.Exit(fmt.Sprintf("Failed to read the index file: %v", err), ExitIndexFile)
+	}
+	defer idx.Close()
+
+	streamingFiles := 0
+
+	for _, file := range files {
+		if dirConfigs.Streaming(file.RelativePath()) {
+			streamingFiles++
+		}
+	}
+
+	if streamingFiles != 0 {
+		slog.Info(fmt.Sprintf("Got %v files for streaming", streamingFiles))
+	}
+
+	rescanCrawlerOptions := []internal.CrawlerOSOption{
+		internal.WithCrawlerReports(scanReports),
+		internal.WithFollowSymlinks(config.FollowSymlinks),
+	}
+	if !config.FullRescan {
+		rescanCrawlerOptions = append(rescanCrawlerOptions, internal.WithKnownTree(idx))
+	}
+
+	rescanCrawler := internal.NewCrawlerOS(config.Dir, rescanCrawlerOptions...)
+	rescanner := internal.NewRescanner(rescanCrawler, idx, indexFilePaths...)
+
+	// the interface is available while the files are processed
 	_ = internal.NewServer(
 		ctx,
-		internal.WithSource(&index),
+		internal.WithSource(idx),
 		internal.WithPort(config.Port),
 		internal.WithPWD(config.Dir),
 		internal.WithDebug(Mode == DebugMode),
-		internal.WithStreaming(streamingFiles),
+		internal.WithDirConfigs(dirConfigs),
+		internal.WithAdmin(idx, config.AdminToken),
+		internal.WithRescan(rescanner),
+		internal.WithScanReports(scanReports),
 	)
 
+	go rescanner.Run(ctx)
+	controlSignals(ctx, idx, rescanner)
 	slog.Info("Server started", slog.Int("port", config.Port), slog.String("mode", Mode))
+
+	if config.Watch {
+		defer previewer.Close()
+	}
+
+	go func() {
+		<-idx.Done()
+
+		if idx.Err() == nil && ctx.Err() == nil {
+			indexingDone(idx, config, indexFilePath)
+		}
+
+		if !config.Watch {
+			previewer.Close()
+
+			return
+		}
+
+		watcher := internal.NewWatcher(
+			config.Dir,
+			idx,
+			internal.WithWatcherExcludes(indexFilePaths...),
+			internal.WithWatcherDirConfigs(dirConfigs),
+			internal.WithWatcherKnownTree(idx),
+		)
+		if err := watcher.Run(ctx); err != nil {
+			slog.Error("The data folder isn't watched", slog.String("error", err.Error()))
+		}
+	}()
+
 	<-ctx.Done()
+	// the interrupted processing is saved, so it continues at the next start
+	<-idx.Done()
+
+	if idx.OutDated() && config.IndexFileSave {
+		count, err := idx.Save(indexFilePath)
+		if err != nil {
+			return cli.Exit(fmt.Sprintf("Failed to save the index file: %v", err), ExitIndexFile)
+		}
+
+		slog.Info("Index file saved", slog.String("size", bytesutil.PrettyByteSize(count)))
+	}
+
 	slog.Info("Successful shutdown")
+
+	return nil
+}
+
+// indexingDone reports the result of processing and saves the index.
+func indexingDone(idx *index.Index, config internal.Config, indexFilePath string) {
+	if collisions := idx.Collisions(); collisions != 0 {
+		slog.Warn("ID collisions resolved with longer IDs", slog.Int("count", collisions))
+	}
+
+	totalFiles, previewFilesCount, previewsSize := idx.FilesWithPreviewStat()
+
+	slog.Info("Indexing done")
+	slog.Info(
+		"Stat",
+		slog.Int("total files", totalFiles),
+		slog.Int("files with preview", previewFilesCount),
+		slog.String("total preview data size", bytesutil.PrettyByteSize(previewsSize)),
+	)
+
+	if failed := idx.Failed(); len(failed) != 0 {
+		slog.Warn(
+			"Some files failed to be processed, run 'tinytune index failed' to see them",
+			slog.Int("count", len(failed)),
+		)
+	}
+
+	if garbage := idx.Garbage(); garbage != 0 {
+		slog.Info(
+			"Thumbnails of removed files take space in the index file, run 'tinytune index compact' to free it",
+			slog.String("size", bytesutil.PrettyByteSize(garbage)),
+		)
+	}
+
+	if idx.OutDated() && config.IndexFileSave {
+		count, err := idx.Save(indexFilePath)
+		if err != nil {
+			slog.Error("Failed to save the index file", slog.String("error", err.Error()))
+
+			return
+		}
+
+		slog.Info("Index file saved", slog.String("size", bytesutil.PrettyByteSize(count)))
+	}
+}
+
+// controlSignals pauses the processing by SIGUSR1, resumes it by SIGUSR2 and rescans the data folder by SIGHUP.
+func controlSignals(ctx context.Context, idx *index.Index, rescanner *internal.Rescanner) {
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, syscall.SIGUSR1, syscall.SIGUSR2, syscall.SIGHUP)
+
+	go func() {
+		defer signal.Stop(signals)
+
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case sig := <-signals:
+				switch sig {
+				case syscall.SIGUSR1:
+					idx.Pause()
+					slog.Info("Processing paused")
+				case syscall.SIGUSR2:
+					idx.Resume()
+					slog.Info("Processing resumed")
+				default:
+					rescanner.Request()
+				}
+			}
+		}
+	}()
 }
 
 func gracefulShutdownCtx() context.Context {
@@ -4,6 +4,7 @@ go 1.24.1
 
 require (
 	github.com/davidbyttow/govips/v2 v2.15.0
+	github.com/fsnotify/fsnotify v1.8.0
 	github.com/hashicorp/go-version v1.7.0
 	github.com/justinas/alice v1.2.0
 	github.com/lmittmann/tint v1.0.6
@@ -11,7 +12,9 @@ require (
 	github.com/schollz/progressbar/v3 v3.17.1
 	github.com/stretchr/testify v1.10.0
 	github.com/urfave/cli/v2 v2.27.5
+	golang.org/x/image v0.23.0
 	golang.org/x/sync v0.11.0
+	gopkg.in/yaml.v3 v3.0.1
 )
 
 require (
@@ -22,10 +25,8 @@ require (
 	github.com/rivo/uniseg v0.4.7 // indirect
 	github.com/russross/blackfriday/v2 v2.1.0 // indirect
 	github.com/xrash/smetrics v0.0.0-20240521201337-686a1a2994c1 // indirect
-	golang.org/x/image v0.23.0 // indirect
 	golang.org/x/net v0.36.0 // indirect
 	golang.org/x/sys v0.30.0 // indirect
 	golang.org/x/term v0.29.0 // indirect
 	golang.org/x/text v0.22.0 // indirect
-	gopkg.in/yaml.v3 v3.0.1 // indirect
 )
@@ -0,0 +1,106 @@
+package internal
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/alxarno/tinytune/pkg/index"
+	"github.com/justinas/alice"
+)
+
+type indexControl interface {
+	Progress() index.Progress
+	Pause()
+	Resume()
+	Cancel()
+	SetWorkers(workers int)
+}
+
+type rescanRequester interface {
+	Request()
+}
+
+// adminAuth allows requests with the admin token given as "Authorization: Bearer <token>".
+func (s Server) adminAuth(handler http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+		if !ok || subtle.ConstantTimeCompare([]byte(token), []byte(s.adminToken)) != 1 {
+			w.WriteHeader(http.StatusUnauthorized)
+
+			return
+		}
+
+		handler.ServeHTTP(w, r)
+	})
+}
+
+// indexingHandler applies the action to the indexing and responds with its state.
+func (s Server) indexingHandler(action func(r *http.Request) bool) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if !action(r) {
+			w.WriteHeader(http.StatusBadRequest)
+
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+
+		if err := json.NewEncoder(w).Encode(s.control.Progress()); err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+		}
+	}
+}
+
+// registerAdminHandlers registers endpoints controlling the indexing, they are available only with the admin token.
+func (s Server) registerAdminHandlers(mux *http.ServeMux, chain alice.Chain) {
+	if s.control == nil || s.adminToken == "" {
+		return
+	}
+
+	chain = chain.Append(s.adminAuth)
+	register := func(route string, action func(r *http.Request) bool) {
+		mux.Handle(route, chain.Then(s.indexingHandler(action)))
+	}
+
+	register("GET /admin/indexing", func(*http.Request) bool { return true })
+
+	if s.rescan != nil {
+		// the rescan runs in background, the index is read meanwhile
+		mux.Handle("POST /admin/rescan", chain.ThenFunc(func(w http.ResponseWriter, _ *http.Request) {
+			s.rescan.Request()
+			w.WriteHeader(http.StatusAccepted)
+		}))
+	}
+
+	register("POST /admin/indexing/pause", func(*http.Request) bool {
+		s.control.Pause()
+
+		return true
+	})
+
+	register("POST /admin/indexing/resume", func(*http.Request) bool {
+		s.control.Resume()
+
+		return true
+	})
+
+	register("POST /admin/indexing/cancel", func(*http.Request) bool {
+		s.control.Cancel()
+
+		return true
+	})
+
+	register("POST /admin/indexing/parallel", func(r *http.Request) bool {
+		workers, err := strconv.Atoi(r.FormValue("value"))
+		if err != nil || workers < 1 {
+			return false
+		}
+
+		s.control.SetWorkers(workers)
+
+		return true
+	})
+}
@@ -0,0 +1,117 @@
+package internal
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/alxarno/tinytune/pkg/index"
+	"github.com/stretchr/testify/require"
+)
+
+type mockIndexControl struct {
+	progress index.Progress
+}
+
+func (c *mockIndexControl) Progress() index.Progress {
+	return c.progress
+}
+
+func (c *mockIndexControl) Pause() {
+	c.progress.Paused = true
+}
+
+func (c *mockIndexControl) Resume() {
+	c.progress.Paused = false
+}
+
+func (c *mockIndexControl) Cancel() {
+	c.progress.Total = c.progress.Done
+}
+
+func (c *mockIndexControl) SetWorkers(workers int) {
+	c.progress.Workers = workers
+}
+
+func TestAdminHandlers(t *testing.T) {
+	t.Parallel()
+	require := require.New(t)
+
+	control := &mockIndexControl{progress: index.Progress{Done: 1, Total: 5, Workers: 4}}
+	rescanner := NewRescanner(mockCrawler{}, &mockIndexRescanner{})
+	server := NewServer(context.Background(), WithAdmin(control, "secret"), WithRescan(rescanner), WithDry())
+	handler := server.registerHandlers(true)
+
+	request := func(method string, path string, token string) (int, index.Progress) {
+		r := httptest.NewRequest(method, path, nil)
+		if token != "" {
+			r.Header.Set("Authorization", "Bearer "+token)
+		}
+
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, r)
+
+		progress := index.Progress{}
+		if w.Code == http.StatusOK {
+			require.NoError(json.NewDecoder(w.Body).Decode(&progress))
+		}
+
+		return w.Code, progress
+	}
+
+	code, _ := request(http.MethodPost, "/admin/indexing/pause", "")
+	require.Equal(http.StatusUnauthorized, code)
+
+	code, _ = request(http.MethodPost, "/admin/indexing/pause", "wrong")
+	require.Equal(http.StatusUnauthorized, code)
+
+	code, progress := request(http.MethodPost, "/admin/indexing/pause", "secret")
+	require.Equal(http.StatusOK, code)
+	require.True(progress.Paused)
+
+	code, progress = request(http.MethodPost, "/admin/indexing/parallel?value=2", "secret")
+	require.Equal(http.StatusOK, code)
+	require.Equal(2, progress.Workers)
+
+	code, _ = request(http.MethodPost, "/admin/indexing/parallel?value=0", "secret")
+	require.Equal(http.StatusBadRequest, code)
+
+	code, progress = request(http.MethodPost, "/admin/indexing/resume", "secret")
+	require.Equal(http.StatusOK, code)
+	require.False(progress.Paused)
+
+	code, progress = request(http.MethodPost, "/admin/indexing/cancel", "secret")
+	require.Equal(http.StatusOK, code)
+	require.False(progress.Active())
+
+	code, progress = request(http.MethodGet, "/admin/indexing", "secret")
+	require.Equal(http.StatusOK, code)
+	require.Equal(index.Progress{Done: 1, Total: 1, Workers: 2}, progress)
+
+	code, _ = request(http.MethodPost, "/admin/rescan", "")
+	require.Equal(http.StatusUnauthorized, code)
+
+	code, _ = request(http.MethodPost, "/admin/rescan", "secret")
+	require.Equal(http.StatusAccepted, code)
+	require.Len(rescanner.requests, 1)
+}
+
+func TestScanReportHandler(t *testing.T) {
+	t.Parallel()
+	require := require.New(t)
+
+	reports := &ScanReports{}
+	reports.Set(ScanReport{Files: 3, Skipped: []SkippedEntry{{Path: "lost+found", Reason: "permission denied"}}})
+
+	server := NewServer(context.Background(), WithScanReports(reports), WithDry())
+	w := httptest.NewRecorder()
+	server.registerHandlers(true).ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/scan-report", nil))
+	require.Equal(http.StatusOK, w.Code)
+
+	report := ScanReport{}
+	require.NoError(json.NewDecoder(w.Body).Decode(&report))
+	require.Equal(3, report.Files)
+	require.Equal([]SkippedEntry{{Path: "lost+found", Reason: "permission denied"}}, report.Skipped)
+}
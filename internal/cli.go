@@ -1,10 +1,13 @@
 package internal
 
 import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
 	"fmt"
 	"log/slog"
 	"os"
-	"regexp"
+	"path/filepath"
 	"runtime"
 	"strings"
 	"time"
@@ -14,7 +17,17 @@ import (
 )
 
 const defaultPort = 8080
-const maxPortNumber = 65536
+const maxPortNumber = 65535
+const indexFileName = "index.tinytune"
+const indexCacheDirName = "tinytune"
+const indexCacheKeySize = 4
+
+var (
+	ErrInvalidOption = errors.New("invalid")
+	ErrNotDir        = errors.New("not a folder")
+	ErrOutOfRange    = errors.New("out of range")
+	ErrUnknownValue  = errors.New("unknown value")
+)
 
 type RawConfig struct {
 	Dir                  string
@@ -24,13 +37,22 @@ type RawConfig struct {
 	Images               bool
 	MaxImages            int64
 	MaxVideos            int64
-	Includes             string
-	Excludes             string
+	Includes             []string
+	Excludes             []string
 	MaxFileSize          string
-	Streaming            string
+	Streaming            []string
 	MediaTimeout         string
 	IndexFileSave        bool
+	IndexPath            string
+	CheckpointInterval   string
+	CheckpointPreviews   int
+	ContentIdentity      bool
+	Watch                bool
+	FullRescan           bool
+	FollowSymlinks       bool
+	RetryFailed          bool
 	Port                 int
+	AdminToken           string
 }
 
 type MediaTypeConfig struct {
@@ -59,22 +81,15 @@ type ProcessConfig struct {
 	VideoAccel  preview.VideoProcessingAccelType
 	Timeout     time.Duration
 	Image       MediaTypeConfig
-	Includes    []*regexp.Regexp
-	Excludes    []*regexp.Regexp
+	Includes    []Pattern
+	Excludes    []Pattern
 	MaxFileSize int64
+	RetryFailed bool
 }
 
 func (c ProcessConfig) Print() {
-	includes := ""
-	excludes := ""
-
-	for _, v := range c.Includes {
-		includes += v.String()
-	}
-
-	for _, v := range c.Excludes {
-		excludes += v.String()
-	}
+	includes := patternsString(c.Includes)
+	excludes := patternsString(c.Excludes)
 
 	params := []any{
 		slog.Int("parallel", c.Parallel),
@@ -96,6 +111,10 @@ func (c ProcessConfig) Print() {
 		params = append(params, slog.String("max-file-size", bytesutil.PrettyByteSize(c.MaxFileSize)))
 	}
 
+	if c.RetryFailed {
+		params = append(params, slog.Bool("retry-failed", c.RetryFailed))
+	}
+
 	if c.VideoAccel != preview.Auto {
 		params = append(params, slog.String("video-processing-accel", string(c.VideoAccel)))
 	}
@@ -109,26 +128,41 @@ func (c ProcessConfig) Print() {
 	c.Video.Print("Video:")
 }
 
+type CheckpointConfig struct {
+	Interval time.Duration
+	Previews int
+}
+
 type Config struct {
-	Dir           string
-	Port          int
-	Streaming     []*regexp.Regexp
-	IndexFileSave bool
-	Process       ProcessConfig
+	Dir             string
+	Port            int
+	Streaming       []Pattern
+	IndexFileSave   bool
+	IndexPath       string
+	Checkpoint      CheckpointConfig
+	ContentIdentity bool
+	Watch           bool
+	FullRescan      bool
+	FollowSymlinks  bool
+	AdminToken      string
+	Process         ProcessConfig
 }
 
 func (c Config) Print() {
-	streamingOriginalPatterns := make([]string, len(c.Streaming))
-	for i, v := range c.Streaming {
-		streamingOriginalPatterns[i] = v.String()
-	}
-
 	slog.Info(
 		"Config:",
 		slog.String("dir", c.Dir),
 		slog.Int("port", c.Port),
-		slog.String("streaming", strings.Join(streamingOriginalPatterns, ",")),
+		slog.String("streaming", patternsString(c.Streaming)),
 		slog.Bool("index-file-saving", c.IndexFileSave),
+		slog.String("index-path", c.IndexPath),
+		slog.String("checkpoint-interval", c.Checkpoint.Interval.String()),
+		slog.Int("checkpoint-previews", c.Checkpoint.Previews),
+		slog.Bool("content-identity", c.ContentIdentity),
+		slog.Bool("watch", c.Watch),
+		slog.Bool("full-rescan", c.FullRescan),
+		slog.Bool("follow-symlinks", c.FollowSymlinks),
+		slog.Bool("admin", c.AdminToken != ""),
 	)
 	c.Process.Print()
 }
@@ -142,67 +176,213 @@ func DefaultRawConfig() RawConfig {
 		Video:                true,
 		Images:               true,
 		IndexFileSave:        true,
+		CheckpointInterval:   "5m",
+		CheckpointPreviews:   500,
 		MaxImages:            -1,
 		MaxVideos:            -1,
 		MaxFileSize:          "-1B",
-		Streaming:            "\\.(flv|f4v|avi|wmv|mov|vob)$",
+		Streaming:            []string{"\\.(flv|f4v|avi|wmv|mov|vob)$"},
 		MediaTimeout:         "2m",
 	}
 }
 
-func NewConfig(raw RawConfig) Config {
-	if raw.Port > maxPortNumber {
-		panic(fmt.Errorf("flag port value out of range[0-65535]: %v", raw.Port)) //nolint:err113
+// NewConfig validates the raw config, all invalid options are reported by the joined error.
+//
+//nolint:funlen
+func NewConfig(raw RawConfig) (Config, error) {
+	validation := configValidation{}
+
+	validation.check("data folder", validDir(raw.Dir))
+	validation.check("--port", validRange(raw.Port, 0, maxPortNumber))
+	validation.check("--parallel", validMin(raw.Parallel, 1))
+	validation.check("--max-images", validMin(raw.MaxImages, -1))
+	validation.check("--max-videos", validMin(raw.MaxVideos, -1))
+	validation.check("--checkpoint-previews", validMin(raw.CheckpointPreviews, 0))
+	validation.check("--video-processing-accel", validAccel(raw.VideoProcessingAccel))
+
+	streaming, err := ParsePatterns(raw.Streaming)
+	validation.check("--streaming", err)
+
+	includes, err := ParsePatterns(raw.Includes)
+	validation.check("--includes", err)
+
+	excludes, err := ParsePatterns(raw.Excludes)
+	validation.check("--excludes", err)
+
+	checkpointInterval, err := parseDuration(raw.CheckpointInterval)
+	validation.check("--checkpoint-interval", err)
+
+	timeout, err := parseDuration(raw.MediaTimeout)
+	validation.check("--timeout", err)
+
+	maxFileSize, err := parseMaxFileSize(raw.MaxFileSize)
+	validation.check("--max-file-size", err)
+
+	if err := validation.err(); err != nil {
+		return Config{}, err
 	}
 
+	warnListedPatterns("--streaming", streaming)
+	warnListedPatterns("--includes", includes)
+	warnListedPatterns("--excludes", excludes)
+
 	return Config{
 		Dir:           raw.Dir,
 		Port:          raw.Port,
-		Streaming:     getRegularExpressions(raw.Streaming),
+		Streaming:     streaming,
 		IndexFileSave: raw.IndexFileSave,
+		IndexPath:     IndexFilePath(raw.Dir, raw.IndexPath),
+		Checkpoint: CheckpointConfig{
+			Interval: checkpointInterval,
+			Previews: raw.CheckpointPreviews,
+		},
+		ContentIdentity: raw.ContentIdentity,
+		Watch:           raw.Watch,
+		FullRescan:      raw.FullRescan,
+		FollowSymlinks:  raw.FollowSymlinks,
+		AdminToken:      raw.AdminToken,
 		Process: ProcessConfig{
-			Timeout:     getDuration(raw.MediaTimeout),
+			Timeout:     timeout,
 			Parallel:    raw.Parallel,
 			Video:       MediaTypeConfig{raw.Video, raw.MaxVideos},
 			VideoAccel:  preview.VideoProcessingAccelType(raw.VideoProcessingAccel),
 			Image:       MediaTypeConfig{raw.Images, raw.MaxImages},
-			Includes:    getRegularExpressions(raw.Includes),
-			Excludes:    getRegularExpressions(raw.Excludes),
-			MaxFileSize: getMaxFileSize(raw.MaxFileSize),
+			Includes:    includes,
+			Excludes:    excludes,
+			MaxFileSize: maxFileSize,
+			RetryFailed: raw.RetryFailed,
 		},
+	}, nil
+}
+
+// warnListedPatterns warns about patterns, which look like lists separated by commas:
+// values aren't split by commas, the option is repeated to specify several patterns.
+func warnListedPatterns(option string, patterns []Pattern) {
+	for _, pattern := range patterns {
+		if pattern.Listed() {
+			slog.Warn(
+				"The pattern contains a comma, it's used as one pattern, repeat the option to specify several patterns",
+				slog.String("option", option),
+				slog.String("pattern", pattern.String()),
+			)
+		}
+	}
+}
+
+// IndexFilePath returns the index file location for the data folder.
+// Unless it's set explicitly, the index file already existing in the data folder is used,
+// otherwise the one in the user's cache directory (XDG_CACHE_HOME), so the data folder can be read-only.
+func IndexFilePath(dir string, path string) string {
+	if path != "" {
+		return path
+	}
+
+	legacyPath := filepath.Join(dir, indexFileName)
+	if _, err := os.Stat(legacyPath); err == nil {
+		return legacyPath
+	}
+
+	cacheDir, err := os.UserCacheDir()
+	if err != nil {
+		return legacyPath
+	}
+
+	absoluteDir, err := filepath.Abs(dir)
+	if err != nil {
+		return legacyPath
 	}
+
+	key := sha256.Sum256([]byte(absoluteDir))
+	folder := fmt.Sprintf("%s-%s", filepath.Base(absoluteDir), hex.EncodeToString(key[:indexCacheKeySize]))
+
+	return filepath.Join(cacheDir, indexCacheDirName, folder, indexFileName)
+}
+
+// configValidation collects errors of the options, so all of them are reported at once.
+type configValidation struct {
+	errs []error
 }
 
-func getDuration(durationEncoded string) time.Duration {
-	duration, err := time.ParseDuration(durationEncoded)
+func (v *configValidation) check(option string, err error) {
 	if err != nil {
-		panic(err)
+		v.errs = append(v.errs, fmt.Errorf("%w %s: %w", ErrInvalidOption, option, err))
 	}
+}
 
-	return duration
+func (v *configValidation) err() error {
+	return errors.Join(v.errs...)
 }
 
-func getMaxFileSize(value string) int64 {
-	maxFileSize := int64(-1)
-	if value != "" {
-		maxFileSize = bytesutil.ParseByteSize(value)
+func validDir(dir string) error {
+	info, err := os.Stat(dir)
+	if err != nil {
+		return err //nolint:wrapcheck
+	}
+
+	if !info.IsDir() {
+		return fmt.Errorf("%w: %s", ErrNotDir, dir)
 	}
 
-	return maxFileSize
+	return nil
 }
 
-func getRegularExpressions(list string) []*regexp.Regexp {
-	patterns := strings.Split(list, ",")
-	compiled := make([]*regexp.Regexp, len(patterns))
+func validRange(value, minValue, maxValue int) error {
+	if value < minValue || value > maxValue {
+		return fmt.Errorf("%w: %d, expected from %d to %d", ErrOutOfRange, value, minValue, maxValue)
+	}
 
-	for i, pattern := range patterns {
-		reg, err := regexp.Compile(pattern)
-		if err != nil {
-			panic(err)
-		}
+	return nil
+}
+
+func validMin[V int | int64](value, minValue V) error {
+	if value < minValue {
+		return fmt.Errorf("%w: %d, expected at least %d", ErrOutOfRange, value, minValue)
+	}
+
+	return nil
+}
+
+func validAccel(value string) error {
+	accel := preview.VideoProcessingAccelType(value)
+	if accel != preview.Auto && accel != preview.Hardware && accel != preview.Software {
+		return fmt.Errorf("%w %q, expected 'auto', 'hardware' or 'software'", ErrUnknownValue, value)
+	}
+
+	return nil
+}
+
+func parseDuration(value string) (time.Duration, error) {
+	duration, err := time.ParseDuration(value)
+	if err != nil {
+		return 0, err //nolint:wrapcheck
+	}
+
+	if duration < 0 {
+		return 0, fmt.Errorf("%w: %s is negative", ErrOutOfRange, value)
+	}
+
+	return duration, nil
+}
+
+// parseMaxFileSize parses the size limit of processed files, -1 turns it off.
+func parseMaxFileSize(value string) (int64, error) {
+	size, err := bytesutil.ParseByteSize(value)
+	if err != nil {
+		return 0, err //nolint:wrapcheck
+	}
+
+	if size < -1 {
+		return 0, fmt.Errorf("%w: %s, expected a size or -1B (no limit)", ErrOutOfRange, value)
+	}
+
+	return size, nil
+}
 
-		compiled[i] = reg
+func patternsString(patterns []Pattern) string {
+	values := make([]string, len(patterns))
+	for i, p := range patterns {
+		values[i] = p.String()
 	}
 
-	return compiled
+	return strings.Join(values, " ")
 }
@@ -0,0 +1,93 @@
+package internal
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/alxarno/tinytune/pkg/bytesutil"
+	"github.com/stretchr/testify/require"
+)
+
+//nolint:paralleltest // environment variables are changed
+func TestIndexFilePath(t *testing.T) {
+	require := require.New(t)
+
+	cacheDir := t.TempDir()
+	dataDir := filepath.Join(t.TempDir(), "media")
+	t.Setenv("XDG_CACHE_HOME", cacheDir)
+	require.NoError(os.Mkdir(dataDir, 0755))
+
+	require.Equal("/tmp/custom.tinytune", IndexFilePath(dataDir, "/tmp/custom.tinytune"))
+
+	cachePath := IndexFilePath(dataDir, "")
+	require.True(strings.HasPrefix(cachePath, filepath.Join(cacheDir, "tinytune", "media-")))
+	require.Equal(indexFileName, filepath.Base(cachePath))
+	require.Equal(cachePath, IndexFilePath(dataDir+"/", ""))
+
+	// the index file existing in the data folder is still used
+	legacyPath := filepath.Join(dataDir, indexFileName)
+	require.NoError(os.WriteFile(legacyPath, []byte{}, 0600))
+	require.Equal(legacyPath, IndexFilePath(dataDir, ""))
+}
+
+func TestNewConfigInvalidPattern(t *testing.T) {
+	t.Parallel()
+	require := require.New(t)
+
+	raw := DefaultRawConfig()
+	raw.Excludes = []string{`\.(mp4|avi)$`, `a{1,2}`, "glob:raw/**"}
+	config, err := NewConfig(raw)
+	require.NoError(err)
+	require.Len(config.Process.Excludes, 3)
+
+	raw.Excludes = []string{"re:("}
+	_, err = NewConfig(raw)
+	require.ErrorIs(err, ErrInvalidPattern)
+	require.ErrorContains(err, "--excludes")
+}
+
+func TestNewConfigInvalidOptions(t *testing.T) {
+	t.Parallel()
+	require := require.New(t)
+
+	raw := DefaultRawConfig()
+	raw.MaxFileSize = "1.5GB"
+	config, err := NewConfig(raw)
+	require.NoError(err)
+	require.Equal(int64(1024*1024*1024*3/2), config.Process.MaxFileSize)
+
+	// only -1 turns the limit off
+	raw.MaxFileSize = "-5MB"
+	_, err = NewConfig(raw)
+	require.ErrorIs(err, ErrOutOfRange)
+	require.ErrorContains(err, "invalid --max-file-size:")
+
+	raw.Dir = filepath.Join(t.TempDir(), "missing")
+	raw.Port = 70000
+	raw.Parallel = 0
+	raw.VideoProcessingAccel = "gpu"
+	raw.MediaTimeout = "5x"
+	raw.CheckpointInterval = "-1m"
+	raw.MaxFileSize = "10XB"
+
+	// all invalid options are reported at once
+	_, err = NewConfig(raw)
+	require.ErrorIs(err, ErrInvalidOption)
+	require.ErrorIs(err, ErrOutOfRange)
+	require.ErrorIs(err, ErrUnknownValue)
+	require.ErrorIs(err, bytesutil.ErrInvalidByteSize)
+
+	for _, option := range []string{
+		"data folder",
+		"--port",
+		"--parallel",
+		"--video-processing-accel",
+		"--timeout",
+		"--checkpoint-interval",
+		"--max-file-size",
+	} {
+		require.ErrorContains(err, "invalid "+option+":")
+	}
+}
@@ -0,0 +1,107 @@
+package internal
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"slices"
+
+	"gopkg.in/yaml.v3"
+)
+
+var (
+	ErrConfigFileRead    = errors.New("failed to read the config file")
+	ErrConfigFileInvalid = errors.New("invalid config file")
+)
+
+// ReadConfigFile reads values of the options from the YAML file, keys are names of the options,
+// repeatable options take lists of values.
+func ReadConfigFile(path string, options []string) (map[string][]string, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrConfigFileRead, err)
+	}
+	defer file.Close()
+
+	document := yaml.Node{}
+	if err := yaml.NewDecoder(file).Decode(&document); err != nil {
+		// the empty file doesn't set anything
+		if errors.Is(err, io.EOF) {
+			return map[string][]string{}, nil
+		}
+
+		return nil, fmt.Errorf("%w (%s): %w", ErrConfigFileInvalid, path, err)
+	}
+
+	values, err := configValues(&document, options)
+	if err != nil {
+		return nil, fmt.Errorf("%w (%s): %w", ErrConfigFileInvalid, path, err)
+	}
+
+	return values, nil
+}
+
+//nolint:err113
+func configValues(document *yaml.Node, options []string) (map[string][]string, error) {
+	values := map[string][]string{}
+
+	if len(document.Content) == 0 {
+		return values, nil
+	}
+
+	mapping := document.Content[0]
+	if mapping.Kind != yaml.MappingNode {
+		return nil, fmt.Errorf("line %d: options are expected", mapping.Line)
+	}
+
+	for i := 0; i+1 < len(mapping.Content); i += 2 {
+		key, value := mapping.Content[i], mapping.Content[i+1]
+
+		if !slices.Contains(options, key.Value) {
+			return nil, fmt.Errorf("line %d: unknown option %q", key.Line, key.Value)
+		}
+
+		switch value.Kind {
+		case yaml.ScalarNode:
+			values[key.Value] = []string{value.Value}
+		case yaml.SequenceNode:
+			values[key.Value] = []string{}
+
+			for _, item := range value.Content {
+				if item.Kind != yaml.ScalarNode {
+					return nil, fmt.Errorf("line %d: %s: values of the list are expected", item.Line, key.Value)
+				}
+
+				values[key.Value] = append(values[key.Value], item.Value)
+			}
+		default:
+			return nil, fmt.Errorf("line %d: %s: a value or a list of values is expected", value.Line, key.Value)
+		}
+	}
+
+	return values, nil
+}
+
+// WriteConfig writes values of the options in the format of the config file, in the order of the names.
+func WriteConfig(w io.Writer, names []string, values map[string]any) error {
+	mapping := yaml.Node{Kind: yaml.MappingNode}
+
+	for _, name := range names {
+		value := yaml.Node{}
+		if err := value.Encode(values[name]); err != nil {
+			return fmt.Errorf("%s: %w", name, err)
+		}
+
+		mapping.Content = append(mapping.Content, &yaml.Node{Kind: yaml.ScalarNode, Value: name}, &value)
+	}
+
+	encoder := yaml.NewEncoder(w)
+	encoder.SetIndent(2) //nolint:mnd
+
+	if err := encoder.Encode(&mapping); err != nil {
+		return err //nolint:wrapcheck
+	}
+
+	return encoder.Close() //nolint:wrapcheck
+}
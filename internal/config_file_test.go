@@ -0,0 +1,63 @@
+package internal
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestReadConfigFile(t *testing.T) {
+	t.Parallel()
+	require := require.New(t)
+
+	options := []string{"port", "video", "excludes"}
+	path := filepath.Join(t.TempDir(), "tinytune.yaml")
+	require.NoError(os.WriteFile(path, []byte("port: 9000\nvideo: false\nexcludes:\n  - glob:raw/**\n  - \\.avi$\n"), 0o600))
+
+	values, err := ReadConfigFile(path, options)
+	require.NoError(err)
+	require.Equal(map[string][]string{
+		"port":     {"9000"},
+		"video":    {"false"},
+		"excludes": {"glob:raw/**", "\\.avi$"},
+	}, values)
+
+	require.NoError(os.WriteFile(path, []byte{}, 0o600))
+	values, err = ReadConfigFile(path, options)
+	require.NoError(err)
+	require.Empty(values)
+
+	for _, content := range []string{"ports: 9000\n", "- port\n", "excludes:\n  glob: raw\n", "excludes:\n  - [a]\n"} {
+		require.NoError(os.WriteFile(path, []byte(content), 0o600))
+		_, err = ReadConfigFile(path, options)
+		require.ErrorIs(err, ErrConfigFileInvalid, content)
+	}
+
+	_, err = ReadConfigFile(filepath.Join(t.TempDir(), "missing.yaml"), options)
+	require.ErrorIs(err, ErrConfigFileRead)
+}
+
+func TestWriteConfig(t *testing.T) {
+	t.Parallel()
+	require := require.New(t)
+
+	options := []string{"port", "video", "excludes"}
+	output := bytes.Buffer{}
+	require.NoError(WriteConfig(&output, options, map[string]any{
+		"port":     8080,
+		"video":    true,
+		"excludes": []string{"glob:raw/**"},
+	}))
+	require.Equal("port: 8080\nvideo: true\nexcludes:\n  - glob:raw/**\n", output.String())
+
+	// the printed config can be read back
+	path := filepath.Join(t.TempDir(), "tinytune.yaml")
+	require.NoError(os.WriteFile(path, output.Bytes(), 0o600))
+
+	values, err := ReadConfigFile(path, options)
+	require.NoError(err)
+	require.Equal(map[string][]string{"port": {"8080"}, "video": {"true"}, "excludes": {"glob:raw/**"}}, values)
+}
@@ -3,20 +3,24 @@ package internal
 import (
 	"errors"
 	"fmt"
+	"io/fs"
+	"log/slog"
 	"os"
 	"path/filepath"
 	"slices"
 	"time"
 
+	"github.com/alxarno/tinytune/pkg/ignore"
 	"github.com/alxarno/tinytune/pkg/index"
 )
 
 var (
 	ErrDirNotFound              = errors.New("directory not found")
 	ErrDirStatFailed            = errors.New("failed os.Stat")
-	ErrDirWalkHandlerFailed     = errors.New("failed filepath.Walk handler")
+	ErrDirWalkHandlerFailed     = errors.New("failed filepath.WalkDir handler")
 	ErrFileRelativePathNotFound = errors.New("file relative path not found")
-	ErrDirWalkFailed            = errors.New("failed filepath.Walk")
+	ErrDirWalkFailed            = errors.New("failed filepath.WalkDir")
+	ErrSymlinkLoop              = errors.New("symbolic link loop")
 )
 
 type RawFile interface {
@@ -30,6 +34,22 @@ type CrawlerOSFile struct {
 	os.FileInfo
 	path         string
 	relativePath string
+	// name of the symbolic link, which target the file info is about
+	name string
+	// realPath is set when symbolic links are followed
+	realPath string
+}
+
+func (cosf CrawlerOSFile) Name() string {
+	if cosf.name != "" {
+		return cosf.name
+	}
+
+	return cosf.FileInfo.Name()
+}
+
+func (cosf CrawlerOSFile) RealPath() string {
+	return cosf.realPath
 }
 
 func (cosf CrawlerOSFile) Path() string {
@@ -40,12 +60,87 @@ func (cosf CrawlerOSFile) RelativePath() string {
 	return cosf.relativePath
 }
 
-type CrawlerOS struct {
+// knownTree is the index of the previous scan, which lets the crawler skip unchanged folders.
+type knownTree interface {
+	PullDir(path index.RelativePath) (*index.Meta, []*index.Meta, error)
+}
+
+// knownFile is the file of an unchanged folder, it's taken from the index without reading the disk.
+type knownFile struct {
+	meta *index.Meta
 	path string
+	// realPath is set when symbolic links are followed
+	realPath string
+}
+
+func (kf knownFile) Path() string {
+	return kf.path
+}
+
+func (kf knownFile) RelativePath() string {
+	return string(kf.meta.RelativePath)
+}
+
+func (kf knownFile) Name() string {
+	return kf.meta.Name
+}
+
+func (kf knownFile) ModTime() time.Time {
+	return kf.meta.ModTime
+}
+
+func (kf knownFile) IsDir() bool {
+	return kf.meta.IsDir
+}
+
+func (kf knownFile) Size() int64 {
+	return kf.meta.OriginSize
+}
+
+func (kf knownFile) RealPath() string {
+	return kf.realPath
+}
+
+type CrawlerOS struct {
+	path           string
+	known          knownTree
+	reports        *ScanReports
+	followSymlinks bool
+}
+
+type CrawlerOSOption func(*CrawlerOS)
+
+// WithKnownTree makes the crawler skip reading folders, which modification time is the same as in the tree,
+// their files are taken from the tree. Files changed in place don't change the folder, so they are missed.
+func WithKnownTree(tree knownTree) CrawlerOSOption {
+	return func(c *CrawlerOS) {
+		c.known = tree
+	}
+}
+
+// WithCrawlerReports keeps the report of each scan in the reports.
+func WithCrawlerReports(reports *ScanReports) CrawlerOSOption {
+	return func(c *CrawlerOS) {
+		c.reports = reports
+	}
+}
+
+// WithFollowSymlinks makes the crawler walk linked folders and list targets of linked files,
+// loops of links are detected by device and inode of the folders.
+func WithFollowSymlinks(follow bool) CrawlerOSOption {
+	return func(c *CrawlerOS) {
+		c.followSymlinks = follow
+	}
 }
 
-func NewCrawlerOS(path string) CrawlerOS {
-	return CrawlerOS{path}
+func NewCrawlerOS(path string, opts ...CrawlerOSOption) CrawlerOS {
+	crawler := CrawlerOS{path: path}
+
+	for _, opt := range opts {
+		opt(&crawler)
+	}
+
+	return crawler
 }
 
 func (c CrawlerOS) Scan(exclude ...string) ([]index.FileMeta, error) {
@@ -58,34 +153,293 @@ func (c CrawlerOS) Scan(exclude ...string) ([]index.FileMeta, error) {
 		return nil, ErrDirNotFound
 	}
 
-	files := []index.FileMeta{}
-	err = filepath.Walk(c.path,
-		func(path string, info os.FileInfo, err error) error {
-			if err != nil {
-				return fmt.Errorf("%w: %w", ErrDirWalkHandlerFailed, err)
-			}
+	root, err := filepath.Abs(c.path)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrDirStatFailed, err)
+	}
 
-			if path == c.path {
+	excludedPaths := make([]string, 0, len(exclude))
+
+	for _, path := range exclude {
+		if absolutePath, err := filepath.Abs(path); err == nil {
+			excludedPaths = append(excludedPaths, absolutePath)
+		}
+	}
+
+	scan := &crawlerScan{
+		crawler:       c,
+		path:          filepath.Clean(c.path),
+		root:          root,
+		excludedPaths: excludedPaths,
+		files:         []index.FileMeta{},
+		ignore:        ignore.NewMatcher(c.path, ignore.Defaults()),
+	}
+
+	// the data folder is walked at its real path, so real paths of the files are known
+	dir := scan.path
+	if c.followSymlinks {
+		if dir, err = filepath.EvalSymlinks(root); err != nil {
+			return nil, fmt.Errorf("%w: %w", ErrDirStatFailed, err)
+		}
+	}
+
+	if err := scan.walk(dir, scan.path, nil); err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrDirWalkFailed, err)
+	}
+
+	if c.reports != nil {
+		c.reports.Set(ScanReport{Time: time.Now(), Files: len(scan.files), Skipped: scan.skipped})
+	}
+
+	return scan.files, nil
+}
+
+// crawlerScan collects files of one Scan.
+type crawlerScan struct {
+	crawler CrawlerOS
+	// path is the cleaned path of the data folder
+	path          string
+	root          string
+	excludedPaths []string
+	files         []index.FileMeta
+	skipped       []SkippedEntry
+	ignore        *ignore.Matcher
+}
+
+// walk collects files under the folder, folders unchanged since the known tree are not read.
+// The folder is read at dir and its files are listed under virtual, they differ for folders reached
+// through symbolic links. parents are the folders above it (including it), they are tracked to detect loops.
+func (s *crawlerScan) walk(dir string, virtual string, parents []fileID) error {
+	return filepath.WalkDir(dir, func(path string, entry fs.DirEntry, err error) error {
+		virtualPath := path
+		if dir != virtual {
+			virtualPath = filepath.Join(virtual, relativeTo(dir, path))
+		}
+
+		if err != nil {
+			// the known folder was removed
+			if path == dir && virtual != s.path && errors.Is(err, fs.ErrNotExist) {
 				return nil
 			}
 
-			if slices.Contains(exclude, path) {
-				return nil
+			// the data folder itself has to be read, otherwise all its items would be removed from the index
+			if virtualPath == s.path {
+				return fmt.Errorf("%w: %w", ErrDirWalkHandlerFailed, err)
+			}
+
+			// unreadable entries are skipped, the rest of the folder is scanned
+			s.skip(virtualPath, err)
+
+			return nil
+		}
+
+		if virtualPath == s.path {
+			return nil
+		}
+
+		relativePath, err := filepath.Rel(s.path, virtualPath)
+		if err != nil {
+			return fmt.Errorf("%w: %w", ErrFileRelativePathNotFound, err)
+		}
+
+		if slices.Contains(s.excludedPaths, filepath.Join(s.root, relativePath)) {
+			return nil
+		}
+
+		if entry.Type()&fs.ModeSymlink != 0 && s.crawler.followSymlinks {
+			return s.follow(path, virtualPath, dir, parents)
+		}
+
+		if s.ignore.Ignored(relativePath, entry.IsDir()) {
+			if entry.IsDir() {
+				return fs.SkipDir
 			}
 
-			relativePath, err := filepath.Rel(c.path, path)
-			if err != nil {
-				return fmt.Errorf("%w: %w", ErrFileRelativePathNotFound, err)
+			return nil
+		}
+
+		info, err := entry.Info()
+		if err != nil {
+			s.skip(virtualPath, err)
+
+			if entry.IsDir() {
+				return fs.SkipDir
 			}
 
-			files = append(files, &CrawlerOSFile{info, path, relativePath})
+			return nil
+		}
+
+		file := &CrawlerOSFile{FileInfo: info, path: virtualPath, relativePath: relativePath}
+		if s.crawler.followSymlinks {
+			// walked folders are real, the linked ones are walked at their targets
+			file.realPath = path
+		}
 
+		// the linked folder is listed with the name of the link
+		if path == dir && dir != virtual {
+			file.name = filepath.Base(virtual)
+		}
+
+		s.files = append(s.files, file)
+
+		if !entry.IsDir() {
 			return nil
+		}
+
+		children, ok := s.unchanged(index.RelativePath(relativePath), info.ModTime(), path)
+		if !ok {
+			return nil
+		}
+
+		if err := s.reuse(children, dir, virtual, s.chain(parents, dir, path)); err != nil {
+			return err
+		}
+
+		return fs.SkipDir
+	})
+}
+
+// follow collects the target of the symbolic link, the linked folder is walked, unless it's one of the parents.
+func (s *crawlerScan) follow(path string, virtualPath string, dir string, parents []fileID) error {
+	realPath, err := filepath.EvalSymlinks(path)
+	if err != nil {
+		s.skip(virtualPath, err)
+
+		return nil
+	}
+
+	info, err := os.Stat(realPath)
+	if err != nil {
+		s.skip(virtualPath, err)
+
+		return nil
+	}
+
+	relativePath, err := filepath.Rel(s.path, virtualPath)
+	if err != nil {
+		return fmt.Errorf("%w: %w", ErrFileRelativePathNotFound, err)
+	}
+
+	if s.ignore.Ignored(relativePath, info.IsDir()) {
+		return nil
+	}
+
+	if !info.IsDir() {
+		s.files = append(s.files, &CrawlerOSFile{
+			FileInfo:     info,
+			path:         virtualPath,
+			relativePath: relativePath,
+			name:         filepath.Base(virtualPath),
+			realPath:     realPath,
 		})
 
+		return nil
+	}
+
+	parents = s.chain(parents, dir, filepath.Dir(path))
+
+	id, ok := newFileID(info)
+	if ok && slices.Contains(parents, id) {
+		s.skip(virtualPath, fmt.Errorf("%w: %s", ErrSymlinkLoop, realPath))
+
+		return nil
+	}
+
+	return s.walk(realPath, virtualPath, append(parents, id))
+}
+
+// chain returns the parents with the folders from dir to path (including both),
+// it's needed only to detect loops of symbolic links.
+func (s *crawlerScan) chain(parents []fileID, dir string, path string) []fileID {
+	if !s.crawler.followSymlinks {
+		return nil
+	}
+
+	chain := slices.Clone(parents)
+
+	for {
+		if info, err := os.Stat(path); err == nil {
+			if id, ok := newFileID(info); ok {
+				chain = append(chain, id)
+			}
+		}
+
+		if path == dir || path == filepath.Dir(path) {
+			return chain
+		}
+
+		path = filepath.Dir(path)
+	}
+}
+
+// skip reports the entry, which couldn't be read.
+func (s *crawlerScan) skip(path string, err error) {
+	if relativePath, relErr := filepath.Rel(s.path, path); relErr == nil {
+		path = relativePath
+	}
+
+	slog.Warn("Skipped unreadable entry", slog.String("path", path), slog.String("error", err.Error()))
+	s.skipped = append(s.skipped, SkippedEntry{Path: path, Reason: err.Error()})
+}
+
+// unchanged returns the known children of the folder, false if the folder was changed since the known tree.
+// The folder is at dirPath on the disk.
+func (s *crawlerScan) unchanged(path index.RelativePath, modTime time.Time, dirPath string) ([]*index.Meta, bool) {
+	if s.crawler.known == nil {
+		return nil, false
+	}
+
+	dir, children, err := s.crawler.known.PullDir(path)
+	if err != nil || !dir.ModTime.Equal(modTime) {
+		return nil, false
+	}
+
+	// the ignore file changed in place doesn't change the folder, so the folder is read again
+	if info, err := os.Lstat(filepath.Join(dirPath, ignore.FileName)); err == nil && info.ModTime().After(modTime) {
+		return nil, false
+	}
+
+	return children, true
+}
+
+// reuse collects the known files of the unchanged folder, its subfolders are checked on the disk,
+// because their changes don't change the modification time of the folder.
+// The folder is read at dir and listed under virtual like in walk.
+func (s *crawlerScan) reuse(children []*index.Meta, dir string, virtual string, parents []fileID) error {
+	for _, child := range children {
+		// files ignored since the folder was indexed
+		if s.ignore.Ignored(string(child.RelativePath), child.IsDir) {
+			continue
+		}
+
+		virtualPath := filepath.Join(s.path, string(child.RelativePath))
+
+		if child.IsDir {
+			path := filepath.Join(dir, relativeTo(virtual, virtualPath))
+			if err := s.walk(path, virtualPath, parents); err != nil {
+				return err
+			}
+
+			continue
+		}
+
+		file := knownFile{meta: child, path: virtualPath}
+		if s.crawler.followSymlinks {
+			file.realPath = child.RealPath
+		}
+
+		s.files = append(s.files, file)
+	}
+
+	return nil
+}
+
+// relativeTo returns the path relative to the base, which the path is under.
+func relativeTo(base string, path string) string {
+	relativePath, err := filepath.Rel(base, path)
 	if err != nil {
-		return nil, fmt.Errorf("%w: %w", ErrDirWalkFailed, err)
+		return path
 	}
 
-	return files, nil
+	return relativePath
 }
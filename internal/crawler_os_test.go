@@ -1,8 +1,12 @@
 package internal
 
 import (
+	"os"
+	"path/filepath"
 	"testing"
+	"time"
 
+	"github.com/alxarno/tinytune/pkg/index"
 	"github.com/stretchr/testify/require"
 )
 
@@ -14,3 +18,171 @@ func TestCrawlerOS(t *testing.T) {
 	require.NoError(err)
 	require.Len(files, 21)
 }
+
+type mockKnownTree map[index.RelativePath][]*index.Meta
+
+func (m mockKnownTree) PullDir(path index.RelativePath) (*index.Meta, []*index.Meta, error) {
+	for _, children := range m {
+		for _, child := range children {
+			if child.RelativePath == path && child.IsDir {
+				return child, m[path], nil
+			}
+		}
+	}
+
+	return nil, nil, index.ErrNotFound
+}
+
+func TestCrawlerOSKnownTree(t *testing.T) {
+	t.Parallel()
+	require := require.New(t)
+
+	root := t.TempDir()
+	require.NoError(os.MkdirAll(filepath.Join(root, "a", "b"), 0o755))
+	require.NoError(os.WriteFile(filepath.Join(root, "a", "x.jpg"), []byte("x"), 0o600))
+	require.NoError(os.WriteFile(filepath.Join(root, "a", "b", "y.jpg"), []byte("y"), 0o600))
+	require.NoError(os.WriteFile(filepath.Join(root, "c.jpg"), []byte("c"), 0o600))
+
+	info, err := os.Stat(filepath.Join(root, "a"))
+	require.NoError(err)
+
+	// "a" is unchanged, so its files are taken from the tree, "a/b" is changed and read from the disk
+	known := mockKnownTree{
+		"": {{RelativePath: "a", Name: "a", IsDir: true, ModTime: info.ModTime()}},
+		"a": {
+			{RelativePath: "a/ghost.jpg", Name: "ghost.jpg", OriginSize: 5, RealPath: "/pool/ghost.jpg"},
+			{RelativePath: "a/b", Name: "b", IsDir: true, ModTime: info.ModTime().Add(-time.Hour)},
+		},
+	}
+
+	files, err := NewCrawlerOS(root, WithKnownTree(known)).Scan()
+	require.NoError(err)
+
+	paths := make([]string, 0, len(files))
+	for _, file := range files {
+		paths = append(paths, file.RelativePath())
+	}
+
+	require.ElementsMatch([]string{"a", "a/ghost.jpg", "a/b", "a/b/y.jpg", "c.jpg"}, paths)
+
+	files, err = NewCrawlerOS(root).Scan()
+	require.NoError(err)
+	require.Len(files, 5)
+
+	// known files keep their real paths, so linked files still share previews
+	for _, followSymlinks := range []bool{false, true} {
+		files, err = NewCrawlerOS(root, WithKnownTree(known), WithFollowSymlinks(followSymlinks)).Scan()
+		require.NoError(err)
+
+		for _, file := range files {
+			if file.RelativePath() == "a/ghost.jpg" {
+				realPath := ""
+				if followSymlinks {
+					realPath = "/pool/ghost.jpg"
+				}
+
+				require.Equal(realPath, file.(index.ResolvedFile).RealPath()) //nolint:forcetypeassert
+			}
+		}
+	}
+}
+
+func TestCrawlerOSUnreadable(t *testing.T) {
+	t.Parallel()
+	require := require.New(t)
+
+	if os.Geteuid() == 0 {
+		t.Skip("permissions aren't checked for root")
+	}
+
+	root := t.TempDir()
+	require.NoError(os.Mkdir(filepath.Join(root, "locked"), 0o755))
+	require.NoError(os.WriteFile(filepath.Join(root, "locked", "x.jpg"), []byte("x"), 0o600))
+	require.NoError(os.WriteFile(filepath.Join(root, "c.jpg"), []byte("c"), 0o600))
+	require.NoError(os.Chmod(filepath.Join(root, "locked"), 0o000))
+	t.Cleanup(func() { _ = os.Chmod(filepath.Join(root, "locked"), 0o755) }) //nolint:gosec
+
+	reports := &ScanReports{}
+	files, err := NewCrawlerOS(root, WithCrawlerReports(reports)).Scan()
+	require.NoError(err)
+	require.Len(files, 2)
+
+	report := reports.Last()
+	require.Equal(2, report.Files)
+	require.Len(report.Skipped, 1)
+	require.Equal("locked", report.Skipped[0].Path)
+}
+
+func TestCrawlerOSFollowSymlinks(t *testing.T) {
+	t.Parallel()
+	require := require.New(t)
+
+	root := t.TempDir()
+	require.NoError(os.MkdirAll(filepath.Join(root, "pool"), 0o755))
+	require.NoError(os.MkdirAll(filepath.Join(root, "albums"), 0o755))
+	require.NoError(os.WriteFile(filepath.Join(root, "pool", "x.jpg"), []byte("x"), 0o600))
+	require.NoError(os.Symlink("..", filepath.Join(root, "pool", "loop")))
+	require.NoError(os.Symlink("../pool", filepath.Join(root, "albums", "a")))
+	require.NoError(os.Symlink("../pool/x.jpg", filepath.Join(root, "albums", "x.jpg")))
+	require.NoError(os.Symlink("nowhere", filepath.Join(root, "broken")))
+
+	files, err := NewCrawlerOS(root).Scan()
+	require.NoError(err)
+	require.Len(files, 7)
+
+	reports := &ScanReports{}
+	files, err = NewCrawlerOS(root, WithFollowSymlinks(true), WithCrawlerReports(reports)).Scan()
+	require.NoError(err)
+
+	realPath, err := filepath.EvalSymlinks(filepath.Join(root, "pool", "x.jpg"))
+	require.NoError(err)
+
+	paths := make([]string, 0, len(files))
+
+	for _, file := range files {
+		paths = append(paths, file.RelativePath())
+		require.Equal(filepath.Base(file.RelativePath()), file.Name())
+
+		if filepath.Base(file.RelativePath()) == "x.jpg" {
+			require.Equal(realPath, file.(index.ResolvedFile).RealPath()) //nolint:forcetypeassert
+		}
+	}
+
+	require.ElementsMatch([]string{"pool", "pool/x.jpg", "albums", "albums/a", "albums/a/x.jpg", "albums/x.jpg"}, paths)
+
+	skipped := make([]string, 0)
+	for _, entry := range reports.Last().Skipped {
+		skipped = append(skipped, entry.Path)
+	}
+
+	require.ElementsMatch([]string{"pool/loop", "albums/a/loop", "broken"}, skipped)
+}
+
+func TestCrawlerOSIgnore(t *testing.T) {
+	t.Parallel()
+	require := require.New(t)
+
+	root := t.TempDir()
+	require.NoError(os.MkdirAll(filepath.Join(root, "raw"), 0o755))
+	require.NoError(os.MkdirAll(filepath.Join(root, "@eaDir"), 0o755))
+	require.NoError(os.MkdirAll(filepath.Join(root, "album"), 0o755))
+	require.NoError(os.WriteFile(filepath.Join(root, ".tinytuneignore"), []byte("*.tmp\nraw/\n"), 0o600))
+	require.NoError(os.WriteFile(filepath.Join(root, "album", ".tinytuneignore"), []byte("!keep.tmp\n"), 0o600))
+	require.NoError(os.WriteFile(filepath.Join(root, "a.jpg"), []byte("a"), 0o600))
+	require.NoError(os.WriteFile(filepath.Join(root, "b.tmp"), []byte("b"), 0o600))
+	require.NoError(os.WriteFile(filepath.Join(root, ".DS_Store"), []byte("junk"), 0o600))
+	require.NoError(os.WriteFile(filepath.Join(root, "raw", "x.jpg"), []byte("x"), 0o600))
+	require.NoError(os.WriteFile(filepath.Join(root, "@eaDir", "thumb.jpg"), []byte("t"), 0o600))
+	require.NoError(os.WriteFile(filepath.Join(root, "album", "keep.tmp"), []byte("k"), 0o600))
+	require.NoError(os.WriteFile(filepath.Join(root, "album", "drop.tmp"), []byte("d"), 0o600))
+
+	files, err := NewCrawlerOS(root).Scan()
+	require.NoError(err)
+
+	paths := make([]string, 0, len(files))
+	for _, file := range files {
+		paths = append(paths, file.RelativePath())
+	}
+
+	require.ElementsMatch([]string{"a.jpg", "album", "album/keep.tmp"}, paths)
+}
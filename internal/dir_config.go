@@ -0,0 +1,223 @@
+package internal
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"log/slog"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"github.com/alxarno/tinytune/pkg/preview"
+	"gopkg.in/yaml.v3"
+)
+
+// DirConfigFileName is the name of folder config files, they can be put in any folder of the data folder.
+const DirConfigFileName = ".tinytune.yaml"
+
+const defaultSort = "Type"
+
+var ErrDirConfigInvalid = errors.New("invalid folder config")
+
+// DirSettings are the settings, which a folder config file overrides for the folder and its sub folders.
+type DirSettings struct {
+	Streaming   []Pattern
+	MaxFileSize int64
+	Image       bool
+	Video       bool
+	Sort        string
+	// Excludes and Includes select files, which aren't processed, they are the same for all folders
+	Excludes []Pattern
+	Includes []Pattern
+}
+
+// dirOverrides are the values of a folder config file, missing ones are inherited from the parent folder.
+type dirOverrides struct {
+	Streaming   []string `yaml:"streaming"`
+	MaxFileSize *string  `yaml:"max-file-size"`
+	Image       *bool    `yaml:"image"`
+	Video       *bool    `yaml:"video"`
+	Sort        *string  `yaml:"sort"`
+}
+
+// DirConfigs resolves the effective settings of paths of the data folder:
+// the base settings are overridden by config files found in the folders above them, deeper ones take precedence.
+// Config files are read once, when a path in their folder is resolved first.
+type DirConfigs struct {
+	root string
+	base DirSettings
+	mu   sync.Mutex
+	// resolved settings by folder path relative to the root
+	settings map[string]DirSettings
+}
+
+func NewDirConfigs(root string, base DirSettings) *DirConfigs {
+	if absoluteRoot, err := filepath.Abs(root); err == nil {
+		root = absoluteRoot
+	}
+
+	if base.Sort == "" {
+		base.Sort = defaultSort
+	}
+
+	return &DirConfigs{
+		root:     root,
+		base:     base,
+		settings: map[string]DirSettings{},
+	}
+}
+
+// Dir returns the settings of the folder, the path is relative to the root.
+func (c *DirConfigs) Dir(relativeDir string) DirSettings {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return c.settingsOf(path.Clean(filepath.ToSlash(relativeDir)))
+}
+
+// File returns the settings of the file, the path is relative to the root.
+func (c *DirConfigs) File(relativePath string) DirSettings {
+	return c.Dir(path.Dir(filepath.ToSlash(relativePath)))
+}
+
+// Streaming reports whether the file should be transcoded for playing in browser.
+func (c *DirConfigs) Streaming(relativePath string) bool {
+	for _, pattern := range c.File(relativePath).Streaming {
+		if pattern.Match(relativePath) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Process returns the processing settings of the media file, it's used by the previewer.
+func (c *DirConfigs) Process(src preview.Source) preview.Settings {
+	settings := c.base
+	excluded := false
+
+	// the path is relative to the working directory, when the data folder is given by the relative path
+	if absolutePath, err := filepath.Abs(src.Path()); err == nil {
+		if relativePath, err := filepath.Rel(c.root, absolutePath); err == nil {
+			settings = c.File(relativePath)
+			excluded = Excluded(relativePath, settings.Includes, settings.Excludes)
+		}
+	}
+
+	return preview.Settings{
+		Image:       settings.Image,
+		Video:       settings.Video,
+		MaxFileSize: settings.MaxFileSize,
+		Excluded:    excluded,
+	}
+}
+
+// Forget drops settings of the folder and its sub folders, so its config file is read again, e.g. after it's changed.
+func (c *DirConfigs) Forget(relativeDir string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	dir := path.Clean(filepath.ToSlash(relativeDir))
+
+	for resolved := range c.settings {
+		if dir == "." || resolved == dir || strings.HasPrefix(resolved, dir+"/") {
+			delete(c.settings, resolved)
+		}
+	}
+}
+
+func (c *DirConfigs) settingsOf(dir string) DirSettings {
+	if settings, ok := c.settings[dir]; ok {
+		return settings
+	}
+
+	parent := c.base
+	if dir != "." {
+		parent = c.settingsOf(path.Dir(dir))
+	}
+
+	overrides, err := c.read(dir)
+	settings := parent
+
+	if err == nil {
+		settings, err = overrides.apply(parent)
+	}
+
+	// the invalid config isn't applied at all
+	if err != nil {
+		slog.Warn("Failed to read the folder config", slog.String("dir", dir), slog.String("error", err.Error()))
+
+		settings = parent
+	}
+
+	c.settings[dir] = settings
+
+	return settings
+}
+
+func (c *DirConfigs) read(dir string) (dirOverrides, error) {
+	overrides := dirOverrides{}
+
+	file, err := os.Open(filepath.Join(c.root, filepath.FromSlash(dir), DirConfigFileName))
+	if errors.Is(err, fs.ErrNotExist) {
+		return overrides, nil
+	}
+
+	if err != nil {
+		return overrides, err //nolint:wrapcheck
+	}
+	defer file.Close()
+
+	// misspelled settings aren't ignored silently
+	decoder := yaml.NewDecoder(file)
+	decoder.KnownFields(true)
+
+	if err := decoder.Decode(&overrides); err != nil && !errors.Is(err, io.EOF) {
+		return overrides, fmt.Errorf("%w: %w", ErrDirConfigInvalid, err)
+	}
+
+	return overrides, nil
+}
+
+// apply returns the settings with the overridden values.
+func (o dirOverrides) apply(settings DirSettings) (DirSettings, error) {
+	if o.Streaming != nil {
+		streaming, err := ParsePatterns(o.Streaming)
+		if err != nil {
+			return settings, fmt.Errorf("%w: streaming: %w", ErrDirConfigInvalid, err)
+		}
+
+		settings.Streaming = streaming
+	}
+
+	if o.MaxFileSize != nil {
+		maxFileSize, err := parseMaxFileSize(*o.MaxFileSize)
+		if err != nil {
+			return settings, fmt.Errorf("%w: max-file-size: %w", ErrDirConfigInvalid, err)
+		}
+
+		settings.MaxFileSize = maxFileSize
+	}
+
+	if o.Sort != nil {
+		if _, ok := getSorts()[*o.Sort]; !ok {
+			return settings, fmt.Errorf("%w: unknown sort %q", ErrDirConfigInvalid, *o.Sort)
+		}
+
+		settings.Sort = *o.Sort
+	}
+
+	if o.Image != nil {
+		settings.Image = *o.Image
+	}
+
+	if o.Video != nil {
+		settings.Video = *o.Video
+	}
+
+	return settings, nil
+}
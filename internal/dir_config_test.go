@@ -0,0 +1,99 @@
+package internal
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/alxarno/tinytune/pkg/index"
+	"github.com/alxarno/tinytune/pkg/preview"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDirConfigs(t *testing.T) {
+	t.Parallel()
+	require := require.New(t)
+
+	root := t.TempDir()
+	require.NoError(os.MkdirAll(filepath.Join(root, "raw-footage", "day1"), 0o755))
+	require.NoError(os.MkdirAll(filepath.Join(root, "camera", "broken"), 0o755))
+	require.NoError(os.MkdirAll(filepath.Join(root, "camera", "negative"), 0o755))
+	require.NoError(os.WriteFile(
+		filepath.Join(root, "raw-footage", DirConfigFileName),
+		[]byte("video: false\nmax-file-size: 10mb\nstreaming:\n  - glob:*.mkv\n"),
+		0o600,
+	))
+	require.NoError(os.WriteFile(
+		filepath.Join(root, "raw-footage", "day1", DirConfigFileName),
+		[]byte("video: true\n"),
+		0o600,
+	))
+	require.NoError(os.WriteFile(filepath.Join(root, "camera", DirConfigFileName), []byte("sort: Last Modified\n"), 0o600))
+	// the invalid config is skipped, the settings of the parent folder are used
+	require.NoError(os.WriteFile(
+		filepath.Join(root, "camera", "broken", DirConfigFileName),
+		[]byte("image: false\nsort: Newest\n"),
+		0o600,
+	))
+	require.NoError(os.WriteFile(
+		filepath.Join(root, "camera", "negative", DirConfigFileName),
+		[]byte("max-file-size: -5MB\n"),
+		0o600,
+	))
+
+	configs := NewDirConfigs(root, DirSettings{
+		Streaming:   mustParse(t, "\\.avi$"),
+		MaxFileSize: -1,
+		Image:       true,
+		Video:       true,
+	})
+
+	base := configs.Dir(".")
+	require.True(base.Video)
+	require.Equal("Type", base.Sort)
+	require.True(configs.Streaming("a.avi"))
+	require.False(configs.Streaming("a.mkv"))
+
+	raw := configs.File("raw-footage/a.mp4")
+	require.False(raw.Video)
+	require.True(raw.Image)
+	require.Equal(int64(10*1024*1024), raw.MaxFileSize)
+	require.True(configs.Streaming("raw-footage/a.mkv"))
+	require.False(configs.Streaming("raw-footage/a.avi"))
+
+	day := configs.Dir("raw-footage/day1")
+	require.True(day.Video)
+	require.Equal(int64(10*1024*1024), day.MaxFileSize)
+
+	require.Equal("Last Modified", configs.Dir("camera").Sort)
+	require.Equal("Last Modified", configs.Dir("camera/broken").Sort)
+	require.True(configs.Dir("camera/broken").Image)
+	require.Equal(int64(-1), configs.Dir("camera/negative").MaxFileSize)
+
+	settings := configs.Process(&index.Meta{AbsolutePath: index.Path(filepath.Join(root, "raw-footage", "a.mp4"))})
+	require.Equal(preview.Settings{Image: true, Video: false, MaxFileSize: 10 * 1024 * 1024}, settings)
+
+	// the changed config is read again after it's forgotten
+	require.NoError(os.WriteFile(filepath.Join(root, "raw-footage", DirConfigFileName), []byte("image: false\n"), 0o600))
+	require.False(configs.Dir("raw-footage/day1").MaxFileSize == -1)
+	configs.Forget("raw-footage")
+	require.Equal(int64(-1), configs.Dir("raw-footage/day1").MaxFileSize)
+	require.False(configs.Dir("raw-footage/day1").Image)
+}
+
+func TestDirConfigsRelativeRoot(t *testing.T) {
+	t.Parallel()
+	require := require.New(t)
+
+	workingDir, err := os.Getwd()
+	require.NoError(err)
+
+	root, err := filepath.Rel(workingDir, t.TempDir())
+	require.NoError(err)
+	require.NoError(os.WriteFile(filepath.Join(root, DirConfigFileName), []byte("image: false\n"), 0o600))
+
+	// items of the index built with the relative root have relative paths
+	configs := NewDirConfigs(root, DirSettings{MaxFileSize: -1, Image: true, Video: true})
+	settings := configs.Process(&index.Meta{AbsolutePath: index.Path(filepath.Join(root, "a.jpg"))})
+	require.False(settings.Image)
+}
@@ -23,16 +23,16 @@ func TestE2e(t *testing.T) {
 
 	index := getIndex(ctx)
 
-	streamingFiles := map[string]struct{}{
-		"video/sample_960x400_ocean_with_audio.flv": {},
-	}
+	dirConfigs := NewDirConfigs("../test", DirSettings{
+		Streaming: mustParse(t, "glob:video/sample_960x400_ocean_with_audio.flv"),
+	})
 
 	server := NewServer(
 		ctx,
 		WithSource(index),
 		WithPWD("../test"),
 		WithDebug(true),
-		WithStreaming(streamingFiles),
+		WithDirConfigs(dirConfigs),
 		WithDry(),
 	)
 	serverHandler := server.registerHandlers(true)
@@ -116,10 +116,11 @@ func getIndex(ctx context.Context) *index.Index {
 	index, err := index.NewIndex(
 		ctx,
 		indexFile,
+		index.WithRoot("../test"),
 		index.WithPreview(previewer),
 		index.WithWorkers(runtime.NumCPU()),
 	)
 	PanicError(err)
 
-	return &index
+	return index
 }
@@ -2,8 +2,6 @@ package internal
 
 import (
 	"errors"
-	"regexp"
-	"strings"
 
 	"github.com/alxarno/tinytune/pkg/index"
 )
@@ -14,18 +12,19 @@ var (
 	ErrExcludes  = errors.New("failed filter exclude files")
 )
 
-func GetExcludedFiles(files []index.FileMeta, included, excluded []*regexp.Regexp) map[string]struct{} {
-	excludedFiles := filter(files, filterHandler(excluded))
-	includedFiles := filter(files, filterHandler(included))
-
-	for include := range includedFiles {
-		delete(excludedFiles, include)
-	}
+func GetExcludedFiles(files []index.FileMeta, included, excluded []Pattern) map[string]struct{} {
+	return filter(files, func(file index.FileMeta) bool {
+		return Excluded(file.RelativePath(), included, excluded)
+	})
+}
 
-	return excludedFiles
+// Excluded reports whether the file isn't processed: it matches one of the excluded patterns, but none of the included.
+// The path is relative to the data folder.
+func Excluded(relativePath string, included, excluded []Pattern) bool {
+	return matchAny(excluded, relativePath) && !matchAny(included, relativePath)
 }
 
-func GetIncludedFiles(files []index.FileMeta, included []*regexp.Regexp) map[string]struct{} {
+func GetIncludedFiles(files []index.FileMeta, included []Pattern) map[string]struct{} {
 	return filter(files, filterHandler(included))
 }
 
@@ -45,14 +44,20 @@ func filter(items []index.FileMeta, filterFunc func(index.FileMeta) bool) map[st
 	return dst
 }
 
-func filterHandler(patterns []*regexp.Regexp) func(index.FileMeta) bool {
+// filterHandler matches paths of the files relative to the data folder,
+// so patterns don't depend on where the data folder is.
+func filterHandler(patterns []Pattern) func(index.FileMeta) bool {
 	return func(file index.FileMeta) bool {
-		for _, p := range patterns {
-			if p.MatchString(strings.ToLower(file.Path())) {
-				return true
-			}
-		}
+		return matchAny(patterns, file.RelativePath())
+	}
+}
 
-		return false
+func matchAny(patterns []Pattern, relativePath string) bool {
+	for _, p := range patterns {
+		if p.Match(relativePath) {
+			return true
+		}
 	}
+
+	return false
 }
@@ -1,27 +1,22 @@
 package internal
 
 import (
-	"regexp"
-	"strings"
+	"context"
+	"path/filepath"
 	"testing"
 
+	"github.com/alxarno/tinytune/pkg/index"
+	"github.com/alxarno/tinytune/pkg/preview"
 	"github.com/stretchr/testify/require"
 )
 
-func mustCompile(t *testing.T, list string) []*regexp.Regexp {
+func mustParse(t *testing.T, values ...string) []Pattern {
 	t.Helper()
 
-	patterns := strings.Split(list, ",")
-	compiled := make([]*regexp.Regexp, len(patterns))
+	patterns, err := ParsePatterns(values)
+	require.NoError(t, err)
 
-	for i, pattern := range patterns {
-		reg, err := regexp.Compile(pattern)
-		require.NoError(t, err)
-
-		compiled[i] = reg
-	}
-
-	return compiled
+	return patterns
 }
 
 func TestIncludesFilter(t *testing.T) {
@@ -32,7 +27,7 @@ func TestIncludesFilter(t *testing.T) {
 	require.NoError(err)
 
 	pattern := "\\.(mp4)$"
-	passFiles := filter(paths, filterHandler(mustCompile(t, pattern)))
+	passFiles := filter(paths, filterHandler(mustParse(t, pattern)))
 	require.Len(passFiles, 3)
 	_, ok := passFiles["../test/sample.mp4"]
 	require.True(ok)
@@ -48,11 +43,38 @@ func TestGetExcludedFiles(t *testing.T) {
 	files, err := NewCrawlerOS("../test/").Scan("index.tinytune")
 	require.NoError(err)
 
-	includePatterns := mustCompile(t, "video/sample[.]mp4$")
-	excludePatterns := mustCompile(t, "\\.(mp4)$")
+	includePatterns := mustParse(t, "video/sample[.]mp4$")
+	excludePatterns := mustParse(t, "\\.(mp4)$")
 
 	excludedFiles := GetExcludedFiles(files, includePatterns, excludePatterns)
 	require.Len(excludedFiles, 2)
 	_, ok := excludedFiles["../test/sample.mp4"]
 	require.True(ok)
 }
+
+func TestPullExcluded(t *testing.T) {
+	t.Parallel()
+	require := require.New(t)
+
+	root := t.TempDir()
+	configs := NewDirConfigs(root, DirSettings{
+		MaxFileSize: -1,
+		Image:       true,
+		Excludes:    mustParse(t, "glob:raw/**"),
+		Includes:    mustParse(t, "glob:raw/keep.jpg"),
+	})
+
+	previewer, err := preview.NewPreviewer(preview.WithVideo(false), preview.WithSettings(configs.Process))
+	require.NoError(err)
+
+	// files are matched, when they are processed, e.g. ones found by the watcher
+	excluded := &index.Meta{AbsolutePath: index.Path(filepath.Join(root, "raw", "a.jpg")), Type: index.ContentTypeImage}
+	data, err := previewer.Pull(context.Background(), excluded)
+	require.NoError(err)
+	require.Empty(data.Data())
+
+	// the file included back is processed, it fails as it's missing
+	included := &index.Meta{AbsolutePath: index.Path(filepath.Join(root, "raw", "keep.jpg")), Type: index.ContentTypeImage}
+	_, err = previewer.Pull(context.Background(), included)
+	require.ErrorIs(err, preview.ErrImagePreview)
+}
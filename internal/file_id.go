@@ -0,0 +1,21 @@
+package internal
+
+import (
+	"os"
+	"syscall"
+)
+
+// fileID identifies the file on the disk, symbolic links to the same folder have the same one.
+type fileID struct {
+	dev uint64
+	ino uint64
+}
+
+func newFileID(info os.FileInfo) (fileID, bool) {
+	stat, ok := info.Sys().(*syscall.Stat_t)
+	if !ok {
+		return fileID{}, false
+	}
+
+	return fileID{dev: uint64(stat.Dev), ino: stat.Ino}, true //nolint:unconvert //the type differs by platform
+}
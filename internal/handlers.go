@@ -1,6 +1,7 @@
 package internal
 
 import (
+	"encoding/json"
 	"fmt"
 	"log/slog"
 	"maps"
@@ -9,6 +10,7 @@ import (
 	"net/url"
 	"path/filepath"
 	"slices"
+	"strconv"
 	"time"
 
 	"github.com/alxarno/tinytune/pkg/httputil"
@@ -23,6 +25,8 @@ type PageData struct {
 	Sorts      []string
 	ActiveSort string
 	Search     string
+	Progress   index.Progress
+	Failed     int
 }
 
 func (s Server) newPageData() PageData {
@@ -39,7 +43,8 @@ func logWriteErr(_ int, err error) {
 	}
 }
 
-func applyCookies(r *http.Request, data PageData) PageData {
+// applyCookies applies the zoom and the sort chosen in the interface, the default sort is used until one is chosen.
+func applyCookies(r *http.Request, data PageData, defaultSort string) PageData {
 	data.Sorts = slices.Sorted(maps.Keys(getSorts()))
 
 	if cookie, err := r.Cookie("zoom"); err == nil {
@@ -50,12 +55,12 @@ func applyCookies(r *http.Request, data PageData) PageData {
 
 	if cookie, err := r.Cookie("sort"); err == nil {
 		if decodedValue, err := url.QueryUnescape(cookie.Value); err != nil {
-			data.ActiveSort = "Type"
+			data.ActiveSort = defaultSort
 		} else {
 			data.ActiveSort = decodedValue
 		}
 	} else {
-		data.ActiveSort = "Type"
+		data.ActiveSort = defaultSort
 	}
 
 	if s, ok := getSorts()[data.ActiveSort]; ok {
@@ -65,8 +70,11 @@ func applyCookies(r *http.Request, data PageData) PageData {
 	return data
 }
 
-func (s Server) handleBasicTemplate(data PageData, w http.ResponseWriter, r *http.Request) {
-	data = applyCookies(r, data)
+// handleBasicTemplate renders the page of the folder, its settings define the default sort.
+func (s Server) handleBasicTemplate(data PageData, dir index.RelativePath, w http.ResponseWriter, r *http.Request) {
+	data = applyCookies(r, data, s.dirConfigs.Dir(string(dir)).Sort)
+	data.Progress = s.source.Progress()
+	data.Failed = len(s.source.Failed())
 
 	w.WriteHeader(http.StatusOK)
 
@@ -92,7 +100,12 @@ func (s Server) indexHandler() httputil.MetaHTTPHandler {
 			return
 		}
 
-		s.handleBasicTemplate(data, w, r)
+		// files of the opened folder are processed first
+		if s.source.Progress().Active() {
+			s.source.Prioritize(dir.ID)
+		}
+
+		s.handleBasicTemplate(data, dir.RelativePath, w, r)
 	}
 }
 
@@ -125,7 +138,46 @@ func (s Server) searchHandler() httputil.MetaHTTPHandler {
 
 		data.Path = append(data.Path, &index.Meta{Name: "Search"})
 		data.Items = s.source.Search(data.Search, dir.ID)
-		s.handleBasicTemplate(data, w, r)
+		s.handleBasicTemplate(data, dir.RelativePath, w, r)
+	}
+}
+
+// failedHandler lists files, which failed to be processed, their items show the reason.
+func (s Server) failedHandler() httputil.MetaHTTPHandler {
+	return func(_, _ *index.Meta, w http.ResponseWriter, r *http.Request) {
+		data := s.newPageData()
+		data.Path = []*index.Meta{{Name: "Failed"}}
+		data.Items = s.source.Failed()
+		s.handleBasicTemplate(data, "", w, r)
+	}
+}
+
+// progressHandler renders the indexing progress, the page polls it while files are processed.
+func (s Server) progressHandler() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		progress := s.source.Progress()
+
+		// the page reloads its items to show new thumbnails
+		if r.URL.Query().Get("done") != strconv.Itoa(progress.Done) {
+			w.Header().Set("HX-Trigger", "indexed")
+		}
+
+		w.WriteHeader(http.StatusOK)
+
+		if err := s.templates["index.html"].ExecuteTemplate(w, "progress", progress); err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+		}
+	}
+}
+
+// scanReportHandler responds with the report of the last scan, it lists entries, which couldn't be read.
+func (s Server) scanReportHandler() http.HandlerFunc {
+	return func(w http.ResponseWriter, _ *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+
+		if err := json.NewEncoder(w).Encode(s.scanReports.Last()); err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+		}
 	}
 }
 
@@ -194,14 +246,24 @@ func (s Server) registerHandlers(silent bool) http.Handler {
 	register("GET /s", s.searchHandler())
 	register("GET /s/{dirID}/", s.searchHandler())
 
+	register("GET /failed", s.failedHandler())
+
 	register("GET /preview/{fileID}/", s.previewHandler())
 
+	mux.Handle("GET /progress", chain.Then(s.progressHandler()))
+
+	if s.scanReports != nil {
+		mux.Handle("GET /scan-report", chain.Then(s.scanReportHandler()))
+	}
+
 	register("GET /origin/{fileID}/", s.originHandler())
 
 	register("GET /hls/{fileID}/", s.hlsIndexHandler())
 
 	register("GET /hls/{fileID}/{chunkID}/", s.hlsChunkHandler())
 
+	s.registerAdminHandlers(mux, chain)
+
 	staticHandler := http.StripPrefix("/static", http.FileServer(http.FS(s.getAssets())))
 	mux.Handle("GET /static/", chain.Then(staticHandler))
 	mux.Handle("GET /debug/pprof/", http.HandlerFunc(pprof.Index))
@@ -76,7 +76,7 @@ func pullHLSChunk(ctx context.Context, meta *index.Meta, name string, timeout ti
 	}
 
 	seekOptions := []string{"-accurate_seek", "-ss", timeutil.String(start), "-to", timeutil.String(end)}
-	inputOptions := []string{"-i", string(meta.AbsolutePath)}
+	inputOptions := []string{"-i", meta.Path()}
 	outputOptions := []string{
 		"-preset", "ultrafast",
 		"-crf", "30",
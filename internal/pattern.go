@@ -0,0 +1,143 @@
+package internal
+
+import (
+	"errors"
+	"fmt"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+var ErrInvalidPattern = errors.New("invalid pattern")
+
+const (
+	regexpPatternPrefix = "re:"
+	globPatternPrefix   = "glob:"
+)
+
+// Pattern matches paths relative to the data folder, case-insensitively.
+// It's a regular expression ("re:" or no prefix) or a glob ("glob:" prefix), the glob without "/"
+// matches the file name in any folder, "**" matches any count of folders.
+type Pattern struct {
+	source string
+	re     *regexp.Regexp
+}
+
+func ParsePattern(value string) (Pattern, error) {
+	expression, isGlob := strings.CutPrefix(value, globPatternPrefix)
+	if isGlob {
+		expression = globExpression(expression)
+	} else {
+		expression = strings.TrimPrefix(value, regexpPatternPrefix)
+	}
+
+	if expression == "" {
+		return Pattern{}, fmt.Errorf("%w %q: it's empty", ErrInvalidPattern, value)
+	}
+
+	re, err := regexp.Compile("(?i)" + expression)
+	if err != nil {
+		return Pattern{}, fmt.Errorf("%w %q: %w", ErrInvalidPattern, value, err)
+	}
+
+	return Pattern{source: value, re: re}, nil
+}
+
+func ParsePatterns(values []string) ([]Pattern, error) {
+	patterns := make([]Pattern, 0, len(values))
+
+	for _, value := range values {
+		pattern, err := ParsePattern(value)
+		if err != nil {
+			return nil, err
+		}
+
+		patterns = append(patterns, pattern)
+	}
+
+	return patterns, nil
+}
+
+// Match reports whether the path relative to the data folder matches the pattern.
+func (p Pattern) Match(relativePath string) bool {
+	return p.re.MatchString(filepath.ToSlash(relativePath))
+}
+
+func (p Pattern) String() string {
+	return p.source
+}
+
+// Listed reports whether the pattern looks like a list of patterns separated by commas, which they were split by
+// before. Commas of regular expression quantifiers and of character classes aren't counted.
+func (p Pattern) Listed() bool {
+	depth := 0
+
+	for i := 0; i < len(p.source); i++ {
+		switch p.source[i] {
+		case '\\':
+			i++
+		case '{', '[':
+			depth++
+		case '}', ']':
+			depth = max(0, depth-1)
+		case ',':
+			if depth == 0 {
+				return true
+			}
+		}
+	}
+
+	return false
+}
+
+// globExpression translates the glob into the regular expression matching the whole path.
+func globExpression(glob string) string {
+	if glob == "" {
+		return ""
+	}
+
+	expression := strings.Builder{}
+	expression.WriteString("^")
+
+	if !strings.Contains(glob, "/") {
+		expression.WriteString("(.*/)?")
+	}
+
+	glob = strings.ToLower(strings.TrimPrefix(glob, "/"))
+
+	for i := 0; i < len(glob); i++ {
+		switch c := glob[i]; {
+		case strings.HasPrefix(glob[i:], "**/"):
+			expression.WriteString("(.*/)?")
+			i += 2
+		case strings.HasPrefix(glob[i:], "**"):
+			expression.WriteString(".*")
+			i++
+		case c == '*':
+			expression.WriteString("[^/]*")
+		case c == '?':
+			expression.WriteString("[^/]")
+		case c == '[':
+			end := strings.IndexByte(glob[i+1:], ']')
+			if end == -1 {
+				expression.WriteString(`\[`)
+
+				continue
+			}
+
+			class := glob[i+1 : i+1+end]
+			if strings.HasPrefix(class, "!") {
+				class = "^" + class[1:]
+			}
+
+			expression.WriteString("[" + class + "]")
+			i += end + 1
+		default:
+			expression.WriteString(regexp.QuoteMeta(string(c)))
+		}
+	}
+
+	expression.WriteString("$")
+
+	return expression.String()
+}
@@ -0,0 +1,71 @@
+package internal
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPatternMatch(t *testing.T) {
+	t.Parallel()
+
+	cases := []struct {
+		pattern string
+		path    string
+		match   bool
+	}{
+		{pattern: `\.(mp4|avi)$`, path: "video/Sample.MP4", match: true},
+		{pattern: `re:^video/`, path: "video/sample.mp4", match: true},
+		{pattern: `re:\.MP4$`, path: "video/sample.mp4", match: true},
+		{pattern: `re:^video/`, path: "old/video/sample.mp4", match: false},
+		{pattern: `re:a{1,2}\.jpg$`, path: "aa.jpg", match: true},
+		{pattern: `glob:*.mp4`, path: "deep/folder/sample.mp4", match: true},
+		{pattern: `glob:*.mp4`, path: "sample.mp4.txt", match: false},
+		{pattern: `glob:video/*.mp4`, path: "video/sample.mp4", match: true},
+		{pattern: `glob:video/*.mp4`, path: "video/nested/sample.mp4", match: false},
+		{pattern: `glob:video/**/*.mp4`, path: "video/nested/sample.mp4", match: true},
+		{pattern: `glob:video/**/*.mp4`, path: "video/sample.mp4", match: true},
+		{pattern: `glob:raw/**`, path: "raw/2024/a.cr2", match: true},
+		{pattern: `glob:img_??.[jp]*`, path: "IMG_01.JPG", match: true},
+		{pattern: `glob:IMG_*.jpg`, path: "img_01.JPG", match: true},
+		{pattern: `glob:[!a]*.jpg`, path: "a.jpg", match: false},
+		{pattern: `glob:a+b (1).jpg`, path: "a+b (1).jpg", match: true},
+	}
+
+	for _, c := range cases {
+		pattern, err := ParsePattern(c.pattern)
+		require.NoError(t, err, c.pattern)
+		assert.Equal(t, c.match, pattern.Match(c.path), "%s %s", c.pattern, c.path)
+	}
+}
+
+func TestParsePatternInvalid(t *testing.T) {
+	t.Parallel()
+
+	for _, value := range []string{"re:(", "glob:", "", `\.(mp4`} {
+		_, err := ParsePattern(value)
+		require.ErrorIs(t, err, ErrInvalidPattern, value)
+	}
+}
+
+func TestPatternListed(t *testing.T) {
+	t.Parallel()
+
+	cases := map[string]bool{
+		`\.mp4$,\.avi$`:     true,
+		`glob:*.mp4,*.avi`:  true,
+		`re:a{1,2}\.jpg$`:   false,
+		`glob:[,]*.jpg`:     false,
+		`a\,b`:              false,
+		`\.(mp4|avi)$`:      false,
+		`glob:a{b,c}d.jpg`:  false,
+		`glob:raw/**/a.jpg`: false,
+	}
+
+	for value, listed := range cases {
+		pattern, err := ParsePattern(value)
+		require.NoError(t, err, value)
+		assert.Equal(t, listed, pattern.Listed(), value)
+	}
+}
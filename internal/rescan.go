@@ -0,0 +1,72 @@
+package internal
+
+import (
+	"context"
+	"log/slog"
+
+	"github.com/alxarno/tinytune/pkg/index"
+)
+
+type crawler interface {
+	Scan(exclude ...string) ([]index.FileMeta, error)
+}
+
+type indexRescanner interface {
+	Rescan(ctx context.Context, files []index.FileMeta) error
+}
+
+// Rescanner crawls the data folder again on request and loads the changes into the index.
+type Rescanner struct {
+	crawler  crawler
+	target   indexRescanner
+	exclude  []string
+	requests chan struct{}
+}
+
+func NewRescanner(crawler crawler, target indexRescanner, exclude ...string) *Rescanner {
+	return &Rescanner{
+		crawler:  crawler,
+		target:   target,
+		exclude:  exclude,
+		requests: make(chan struct{}, 1),
+	}
+}
+
+// Request schedules the rescan, requests made before it starts are merged into one.
+func (r *Rescanner) Request() {
+	select {
+	case r.requests <- struct{}{}:
+	default:
+	}
+}
+
+// Run rescans the data folder on requests until the context is done.
+func (r *Rescanner) Run(ctx context.Context) {
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-r.requests:
+			r.rescan(ctx)
+		}
+	}
+}
+
+func (r *Rescanner) rescan(ctx context.Context) {
+	slog.Info("Rescan started")
+
+	files, err := r.crawler.Scan(r.exclude...)
+	if err != nil {
+		slog.Error("Failed to rescan the data folder", slog.String("error", err.Error()))
+
+		return
+	}
+
+	if err := r.target.Rescan(ctx, files); err != nil {
+		slog.Error("Failed to update the index", slog.String("error", err.Error()))
+
+		return
+	}
+
+	slog.Info("Rescan done", slog.Int("files", len(files)))
+}
@@ -0,0 +1,63 @@
+package internal
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/alxarno/tinytune/pkg/index"
+	"github.com/stretchr/testify/require"
+)
+
+type mockCrawler struct {
+	files []index.FileMeta
+}
+
+func (c mockCrawler) Scan(_ ...string) ([]index.FileMeta, error) {
+	return c.files, nil
+}
+
+type mockIndexRescanner struct {
+	mu    sync.Mutex
+	scans [][]index.FileMeta
+}
+
+func (r *mockIndexRescanner) Rescan(_ context.Context, files []index.FileMeta) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.scans = append(r.scans, files)
+
+	return nil
+}
+
+func (r *mockIndexRescanner) count() int {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	return len(r.scans)
+}
+
+func TestRescanner(t *testing.T) {
+	t.Parallel()
+
+	files := []index.FileMeta{&CrawlerOSFile{relativePath: "a.jpg"}}
+	target := &mockIndexRescanner{}
+	rescanner := NewRescanner(mockCrawler{files}, target)
+
+	// requests made before the rescan starts are merged
+	rescanner.Request()
+	rescanner.Request()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	go rescanner.Run(ctx)
+
+	require.Eventually(t, func() bool { return target.count() == 1 }, time.Second, 10*time.Millisecond)
+
+	rescanner.Request()
+	require.Eventually(t, func() bool { return target.count() == 2 }, time.Second, 10*time.Millisecond)
+	require.Equal(t, files, target.scans[1])
+}
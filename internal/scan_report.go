@@ -0,0 +1,39 @@
+package internal
+
+import (
+	"sync"
+	"time"
+)
+
+// SkippedEntry is the entry of the data folder, which couldn't be read by the scan.
+type SkippedEntry struct {
+	Path   string `json:"path"`
+	Reason string `json:"reason"`
+}
+
+// ScanReport is the result of the scan, the skipped entries don't stop it.
+type ScanReport struct {
+	Time    time.Time      `json:"time"`
+	Files   int            `json:"files"`
+	Skipped []SkippedEntry `json:"skipped"`
+}
+
+// ScanReports keeps the report of the last scan, it's written by the crawler and read by the server.
+type ScanReports struct {
+	mu   sync.RWMutex
+	last ScanReport
+}
+
+func (r *ScanReports) Set(report ScanReport) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.last = report
+}
+
+func (r *ScanReports) Last() ScanReport {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	return r.last
+}
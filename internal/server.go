@@ -21,16 +21,26 @@ type source interface {
 	PullPaths(dirID index.ID) ([]*index.Meta, error)
 	Pull(fileID index.ID) (*index.Meta, error)
 	Search(query string, dirID index.ID) []*index.Meta
+	Progress() index.Progress
+	Failed() []*index.Meta
+	Prioritize(dirID index.ID)
 }
 
 type Server struct {
 	templates map[string]*template.Template
-	streaming map[string]struct{}
-	source    source
-	pwd       string
-	port      int
-	debugMode bool
-	dryMode   bool
+	// settings of folders, such as the default sort and files for streaming
+	dirConfigs *DirConfigs
+	source     source
+	pwd        string
+	port       int
+	debugMode  bool
+	dryMode    bool
+	// control of the indexing by the admin endpoints, they are disabled without the token
+	control    indexControl
+	adminToken string
+	rescan     rescanRequester
+	// report of the last scan of the data folder
+	scanReports *ScanReports
 }
 
 func (s Server) getTemplates() fs.FS {
@@ -65,6 +75,28 @@ func WithSource(source source) ServerOption {
 	}
 }
 
+// WithAdmin enables the admin endpoints controlling the indexing, requests have to be authorized by the token.
+func WithAdmin(control indexControl, token string) ServerOption {
+	return func(s *Server) {
+		s.control = control
+		s.adminToken = token
+	}
+}
+
+// WithRescan enables the admin endpoint requesting the rescan of the data folder.
+func WithRescan(rescan rescanRequester) ServerOption {
+	return func(s *Server) {
+		s.rescan = rescan
+	}
+}
+
+// WithScanReports enables the endpoint with the report of the last scan of the data folder.
+func WithScanReports(reports *ScanReports) ServerOption {
+	return func(s *Server) {
+		s.scanReports = reports
+	}
+}
+
 func WithPort(port int) ServerOption {
 	return func(s *Server) {
 		s.port = port
@@ -83,9 +115,10 @@ func WithPWD(dir string) ServerOption {
 	}
 }
 
-func WithStreaming(files map[string]struct{}) ServerOption {
+// WithDirConfigs sets settings of folders, otherwise config files of the data folder override the default ones.
+func WithDirConfigs(configs *DirConfigs) ServerOption {
 	return func(s *Server) {
-		s.streaming = files
+		s.dirConfigs = configs
 	}
 }
 
@@ -102,7 +135,11 @@ func NewServer(ctx context.Context, opts ...ServerOption) *Server {
 		opt(server)
 	}
 
-	server.templates = loadTemplates(server.getTemplates(), server.streaming)
+	if server.dirConfigs == nil {
+		server.dirConfigs = NewDirConfigs(server.pwd, DirSettings{})
+	}
+
+	server.templates = loadTemplates(server.getTemplates(), server.dirConfigs.Streaming)
 
 	serverTimeoutSeconds := 30
 	httpServer := &http.Server{
@@ -6,10 +6,11 @@ import (
 	"path"
 	"strings"
 
+	"github.com/alxarno/tinytune/pkg/index"
 	"github.com/alxarno/tinytune/pkg/timeutil"
 )
 
-func loadTemplates(src fs.FS, streaming map[string]struct{}) map[string]*template.Template {
+func loadTemplates(src fs.FS, streaming func(relativePath string) bool) map[string]*template.Template {
 	templates := make(map[string]*template.Template)
 	funcs := template.FuncMap{
 		"ext": extension,
@@ -33,10 +34,8 @@ func extension(name string) string {
 	return ""
 }
 
-func getStreaming(files map[string]struct{}) func(path string) bool {
-	return func(path string) bool {
-		_, ok := files[path]
-
-		return ok
+func getStreaming(streaming func(relativePath string) bool) func(item *index.Meta) bool {
+	return func(item *index.Meta) bool {
+		return streaming(string(item.RelativePath))
 	}
 }
@@ -0,0 +1,381 @@
+package internal
+
+import (
+	"cmp"
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"slices"
+	"time"
+
+	"github.com/alxarno/tinytune/pkg/ignore"
+	"github.com/alxarno/tinytune/pkg/index"
+	"github.com/fsnotify/fsnotify"
+)
+
+var (
+	ErrWatcherCreate = errors.New("failed to create filesystem watcher")
+	ErrWatcherAdd    = errors.New("failed to watch directory")
+)
+
+const defaultWatcherDelay = time.Second
+
+type indexUpdater interface {
+	Update(ctx context.Context, files []index.FileMeta) error
+	Remove(paths ...index.RelativePath) error
+}
+
+// knownDirs lists the indexed items by their folder, the root's items are listed by the empty ID.
+type knownDirs interface {
+	PullChildren(id index.ID) ([]*index.Meta, error)
+}
+
+// Watcher follows changes of the data folder and applies them to the index.
+type Watcher struct {
+	root    string
+	target  indexUpdater
+	exclude []string
+	ignore  *ignore.Matcher
+	// settings of folders, which are read again after their config files change
+	dirConfigs *DirConfigs
+	// folders to watch at the start, they are taken from the index instead of the disk
+	known knownDirs
+	// changes are applied after there were no new ones for the delay,
+	// so a file being copied isn't processed many times
+	delay time.Duration
+}
+
+type WatcherOption func(*Watcher)
+
+func WithWatcherExcludes(paths ...string) WatcherOption {
+	return func(w *Watcher) {
+		for _, path := range paths {
+			if absolutePath, err := filepath.Abs(path); err == nil {
+				w.exclude = append(w.exclude, absolutePath)
+			}
+		}
+	}
+}
+
+func WithWatcherDelay(delay time.Duration) WatcherOption {
+	return func(w *Watcher) {
+		w.delay = delay
+	}
+}
+
+// WithWatcherDirConfigs makes changed folder config files apply to files changed afterwards.
+func WithWatcherDirConfigs(configs *DirConfigs) WatcherOption {
+	return func(w *Watcher) {
+		w.dirConfigs = configs
+	}
+}
+
+// WithWatcherKnownTree makes the folders of the index be watched at the start, so the data folder isn't read again.
+func WithWatcherKnownTree(known knownDirs) WatcherOption {
+	return func(w *Watcher) {
+		w.known = known
+	}
+}
+
+func NewWatcher(root string, target indexUpdater, opts ...WatcherOption) *Watcher {
+	watcher := &Watcher{
+		root:    root,
+		target:  target,
+		exclude: []string{},
+		ignore:  ignore.NewMatcher(root, ignore.Defaults()),
+		delay:   defaultWatcherDelay,
+	}
+
+	for _, opt := range opts {
+		opt(watcher)
+	}
+
+	return watcher
+}
+
+// Run watches the data folder until the context is done.
+func (w *Watcher) Run(ctx context.Context) error {
+	fsWatcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		return fmt.Errorf("%w: %w", ErrWatcherCreate, err)
+	}
+	defer fsWatcher.Close()
+
+	if err := w.watchStart(fsWatcher); err != nil {
+		return err
+	}
+
+	changed := map[string]struct{}{}
+	timer := time.NewTimer(w.delay)
+	timer.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case event, ok := <-fsWatcher.Events:
+			if !ok {
+				return nil
+			}
+
+			// the changed rules apply to files changed afterwards, the rest is updated by a rescan
+			if filepath.Base(event.Name) == ignore.FileName {
+				if dir, err := filepath.Rel(w.root, filepath.Dir(event.Name)); err == nil {
+					w.ignore.Forget(dir)
+				}
+
+				continue
+			}
+
+			if filepath.Base(event.Name) == DirConfigFileName {
+				if dir, err := filepath.Rel(w.root, filepath.Dir(event.Name)); err == nil && w.dirConfigs != nil {
+					w.dirConfigs.Forget(dir)
+				}
+
+				continue
+			}
+
+			if w.excluded(event.Name) {
+				continue
+			}
+
+			changed[event.Name] = struct{}{}
+			timer.Reset(w.delay)
+		case err, ok := <-fsWatcher.Errors:
+			if !ok {
+				return nil
+			}
+
+			slog.Warn("Filesystem watcher error", slog.String("error", err.Error()))
+		case <-timer.C:
+			w.apply(ctx, fsWatcher, changed)
+			changed = map[string]struct{}{}
+		}
+	}
+}
+
+func (w *Watcher) excluded(path string) bool {
+	absolutePath, err := filepath.Abs(path)
+	if err != nil {
+		return false
+	}
+
+	return slices.Contains(w.exclude, absolutePath)
+}
+
+func (w *Watcher) ignored(path string, isDir bool) bool {
+	relativePath, err := filepath.Rel(w.root, path)
+	if err != nil {
+		return false
+	}
+
+	return w.ignore.Ignored(relativePath, isDir)
+}
+
+// apply updates the index with the changed paths, removed ones are dropped from it.
+func (w *Watcher) apply(ctx context.Context, fsWatcher *fsnotify.Watcher, changed map[string]struct{}) {
+	updated := map[string]index.FileMeta{}
+	removed := []index.RelativePath{}
+
+	for path := range changed {
+		relativePath, err := filepath.Rel(w.root, path)
+		if err != nil {
+			continue
+		}
+
+		info, err := os.Lstat(path)
+		if errors.Is(err, fs.ErrNotExist) {
+			// the watch of the renamed folder follows it under the old name
+			_ = fsWatcher.Remove(path)
+			removed = append(removed, index.RelativePath(relativePath))
+
+			continue
+		}
+
+		if err != nil {
+			slog.Warn(
+				"Failed to stat the changed file",
+				slog.String("path", path),
+				slog.String("error", err.Error()),
+			)
+
+			continue
+		}
+
+		if w.ignore.Ignored(relativePath, info.IsDir()) {
+			continue
+		}
+
+		if !info.IsDir() {
+			updated[relativePath] = &CrawlerOSFile{FileInfo: info, path: path, relativePath: relativePath}
+
+			continue
+		}
+
+		// files could be created in the new folder before it's watched
+		files, err := w.watchTree(fsWatcher, path, true)
+		if err != nil {
+			slog.Warn("Failed to watch the folder", slog.String("path", path), slog.String("error", err.Error()))
+		}
+
+		for _, file := range files {
+			updated[file.RelativePath()] = file
+		}
+	}
+
+	files := make([]index.FileMeta, 0, len(updated))
+	for _, file := range updated {
+		files = append(files, file)
+	}
+
+	// parents go before their children
+	slices.SortFunc(files, func(a, b index.FileMeta) int {
+		return cmp.Compare(a.RelativePath(), b.RelativePath())
+	})
+
+	// moved files are updated before their old paths are removed, so they can keep their items
+	if len(files) != 0 {
+		if err := w.target.Update(ctx, files); err != nil {
+			slog.Error("Failed to update the index", slog.String("error", err.Error()))
+		}
+	}
+
+	if len(removed) != 0 {
+		if err := w.target.Remove(removed...); err != nil {
+			slog.Error("Failed to update the index", slog.String("error", err.Error()))
+		}
+	}
+
+	slog.Info("Index updated", slog.Int("changed", len(files)), slog.Int("removed", len(removed)))
+}
+
+// watchStart watches the data folder with its sub folders, they are taken from the known tree, if it's given.
+func (w *Watcher) watchStart(fsWatcher *fsnotify.Watcher) error {
+	if w.known == nil {
+		_, err := w.watchTree(fsWatcher, w.root, false)
+
+		return err
+	}
+
+	if err := fsWatcher.Add(w.root); err != nil {
+		return fmt.Errorf("%w (%s): %w", ErrWatcherAdd, w.root, err)
+	}
+
+	w.watchKnown(fsWatcher, "")
+
+	return nil
+}
+
+// watchKnown watches the known sub folders of the folder, the folder is given by its ID.
+func (w *Watcher) watchKnown(fsWatcher *fsnotify.Watcher, id index.ID) {
+	children, err := w.known.PullChildren(id)
+	if err != nil {
+		return
+	}
+
+	for _, child := range children {
+		if !child.IsDir {
+			continue
+		}
+
+		path := filepath.Join(w.root, string(child.RelativePath))
+		if w.excluded(path) {
+			continue
+		}
+
+		if err := fsWatcher.Add(path); err != nil {
+			w.skip(path, fmt.Errorf("%w: %w", ErrWatcherAdd, err))
+
+			continue
+		}
+
+		w.watchKnown(fsWatcher, child.ID)
+	}
+}
+
+// watchTree watches the folder with its sub folders, returns files found in them, if they are collected.
+// Entries, which can't be read or watched, are skipped.
+func (w *Watcher) watchTree(fsWatcher *fsnotify.Watcher, dir string, collect bool) ([]index.FileMeta, error) {
+	files := []index.FileMeta{}
+
+	err := filepath.WalkDir(dir, func(path string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			// the folder itself has to be read, its unreadable entries are skipped
+			if path == dir {
+				return fmt.Errorf("%w: %w", ErrDirWalkHandlerFailed, err)
+			}
+
+			w.skip(path, err)
+
+			return nil
+		}
+
+		// files aren't stated, when only folders are watched
+		if !collect && !entry.IsDir() {
+			return nil
+		}
+
+		if w.excluded(path) {
+			return nil
+		}
+
+		if path != w.root && w.ignored(path, entry.IsDir()) {
+			if entry.IsDir() {
+				return fs.SkipDir
+			}
+
+			return nil
+		}
+
+		if entry.IsDir() {
+			// e.g. the limit of watches is reached, the folder's changes are picked up by rescans
+			if err := fsWatcher.Add(path); err != nil {
+				if path == dir {
+					return fmt.Errorf("%w (%s): %w", ErrWatcherAdd, path, err)
+				}
+
+				w.skip(path, fmt.Errorf("%w: %w", ErrWatcherAdd, err))
+
+				return fs.SkipDir
+			}
+		}
+
+		if path == w.root || !collect {
+			return nil
+		}
+
+		info, err := entry.Info()
+		if err != nil {
+			w.skip(path, err)
+
+			return nil
+		}
+
+		relativePath, err := filepath.Rel(w.root, path)
+		if err != nil {
+			return fmt.Errorf("%w: %w", ErrFileRelativePathNotFound, err)
+		}
+
+		files = append(files, &CrawlerOSFile{FileInfo: info, path: path, relativePath: relativePath})
+
+		return nil
+	})
+	if err != nil {
+		return files, fmt.Errorf("%w: %w", ErrDirWalkFailed, err)
+	}
+
+	return files, nil
+}
+
+// skip logs the entry, which can't be read or watched, the rest of the folder is watched.
+func (w *Watcher) skip(path string, err error) {
+	if relativePath, relErr := filepath.Rel(w.root, path); relErr == nil {
+		path = relativePath
+	}
+
+	slog.Warn("Skipped unwatchable entry", slog.String("path", path), slog.String("error", err.Error()))
+}
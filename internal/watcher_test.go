@@ -0,0 +1,179 @@
+package internal
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"slices"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/alxarno/tinytune/pkg/index"
+	"github.com/stretchr/testify/require"
+)
+
+type mockIndexUpdater struct {
+	mu      sync.Mutex
+	updated []string
+	removed []index.RelativePath
+}
+
+func (m *mockIndexUpdater) Update(_ context.Context, files []index.FileMeta) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for _, file := range files {
+		m.updated = append(m.updated, file.RelativePath())
+	}
+
+	return nil
+}
+
+func (m *mockIndexUpdater) Remove(paths ...index.RelativePath) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.removed = append(m.removed, paths...)
+
+	return nil
+}
+
+func (m *mockIndexUpdater) changes() ([]string, []index.RelativePath) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	return m.updated, m.removed
+}
+
+func TestWatcher(t *testing.T) {
+	t.Parallel()
+	require := require.New(t)
+
+	root := t.TempDir()
+	require.NoError(os.Mkdir(filepath.Join(root, "old"), 0o755))
+	require.NoError(os.WriteFile(filepath.Join(root, "old", "a.jpg"), []byte("a"), 0o600))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	updater := &mockIndexUpdater{}
+	watcher := NewWatcher(
+		root,
+		updater,
+		WithWatcherDelay(50*time.Millisecond),
+		WithWatcherExcludes(filepath.Join(root, "index.tinytune")),
+	)
+
+	done := make(chan error)
+	go func() { done <- watcher.Run(ctx) }()
+
+	// give the watcher time to start watching
+	time.Sleep(100 * time.Millisecond)
+
+	require.NoError(os.WriteFile(filepath.Join(root, "index.tinytune"), []byte("index"), 0o600))
+	require.NoError(os.Mkdir(filepath.Join(root, "new"), 0o755))
+	require.NoError(os.WriteFile(filepath.Join(root, "new", "b.jpg"), []byte("b"), 0o600))
+	require.NoError(os.WriteFile(filepath.Join(root, "new", ".DS_Store"), []byte("junk"), 0o600))
+	require.NoError(os.RemoveAll(filepath.Join(root, "old")))
+
+	require.Eventually(func() bool {
+		updated, removed := updater.changes()
+
+		return slices.Contains(updated, filepath.Join("new", "b.jpg")) && slices.Contains(removed, "old")
+	}, time.Second, 10*time.Millisecond)
+
+	updated, _ := updater.changes()
+	require.Contains(updated, "new")
+	require.NotContains(updated, "index.tinytune")
+	require.NotContains(updated, filepath.Join("new", ".DS_Store"))
+
+	cancel()
+	require.NoError(<-done)
+}
+
+func TestWatcherUnreadable(t *testing.T) {
+	t.Parallel()
+	require := require.New(t)
+
+	if os.Geteuid() == 0 {
+		t.Skip("permissions aren't checked for root")
+	}
+
+	root := t.TempDir()
+	require.NoError(os.Mkdir(filepath.Join(root, "locked"), 0o755))
+	require.NoError(os.Mkdir(filepath.Join(root, "locked", "inner"), 0o755))
+	require.NoError(os.Chmod(filepath.Join(root, "locked"), 0o000))
+	t.Cleanup(func() { _ = os.Chmod(filepath.Join(root, "locked"), 0o755) }) //nolint:gosec
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	updater := &mockIndexUpdater{}
+	watcher := NewWatcher(root, updater, WithWatcherDelay(50*time.Millisecond))
+
+	done := make(chan error)
+	go func() { done <- watcher.Run(ctx) }()
+
+	// the unreadable folder is skipped, the rest is watched
+	time.Sleep(100 * time.Millisecond)
+	require.NoError(os.WriteFile(filepath.Join(root, "a.jpg"), []byte("a"), 0o600))
+
+	require.Eventually(func() bool {
+		updated, _ := updater.changes()
+
+		return slices.Contains(updated, "a.jpg")
+	}, time.Second, 10*time.Millisecond)
+
+	cancel()
+	require.NoError(<-done)
+}
+
+type mockKnownDirs map[index.ID][]*index.Meta
+
+func (m mockKnownDirs) PullChildren(id index.ID) ([]*index.Meta, error) {
+	return m[id], nil
+}
+
+func TestWatcherKnownTree(t *testing.T) {
+	t.Parallel()
+	require := require.New(t)
+
+	root := t.TempDir()
+	require.NoError(os.Mkdir(filepath.Join(root, "known"), 0o755))
+	require.NoError(os.Mkdir(filepath.Join(root, "unknown"), 0o755))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	// only folders of the tree are watched, the disk isn't read
+	updater := &mockIndexUpdater{}
+	watcher := NewWatcher(
+		root,
+		updater,
+		WithWatcherDelay(50*time.Millisecond),
+		WithWatcherKnownTree(mockKnownDirs{
+			"":  {{ID: "k", RelativePath: "known", IsDir: true}, {ID: "a", RelativePath: "a.jpg"}},
+			"k": {{ID: "g", RelativePath: "known/gone", IsDir: true}},
+		}),
+	)
+
+	done := make(chan error)
+	go func() { done <- watcher.Run(ctx) }()
+
+	time.Sleep(100 * time.Millisecond)
+	require.NoError(os.WriteFile(filepath.Join(root, "unknown", "c.jpg"), []byte("c"), 0o600))
+	require.NoError(os.WriteFile(filepath.Join(root, "known", "b.jpg"), []byte("b"), 0o600))
+
+	require.Eventually(func() bool {
+		updated, _ := updater.changes()
+
+		return slices.Contains(updated, filepath.Join("known", "b.jpg"))
+	}, time.Second, 10*time.Millisecond)
+
+	updated, _ := updater.changes()
+	require.NotContains(updated, filepath.Join("unknown", "c.jpg"))
+
+	cancel()
+	require.NoError(<-done)
+}
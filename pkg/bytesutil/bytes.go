@@ -1,16 +1,27 @@
 package bytesutil
 
 import (
+	"errors"
 	"fmt"
 	"math"
 	"regexp"
+	"slices"
 	"strconv"
 	"strings"
 )
 
+const kilo = 1024.0
+
+var ErrInvalidByteSize = errors.New("invalid size")
+
+//nolint:gochecknoglobals
+var (
+	byteSizeExpression = regexp.MustCompile(`^\s*(-?\d+(?:\.\d+)?)\s*([a-zA-Z]*)\s*$`)
+	byteSizeUnits      = []string{"B", "KB", "MB", "GB", "TB", "PB", "EB"}
+)
+
 func PrettyByteSize[V int64 | uint64 | uint32 | int](b V) string {
 	byteSize := float64(b)
-	kilo := 1024.0
 
 	for _, unit := range []string{"", "K", "M", "G", "T", "P", "E", "Z"} {
 		if math.Abs(byteSize) < kilo {
@@ -23,24 +34,38 @@ func PrettyByteSize[V int64 | uint64 | uint32 | int](b V) string {
 	return fmt.Sprintf("%.1fYB", byteSize)
 }
 
-func ParseByteSize(size string) int64 {
-	coefficients := []string{"", "KB", "MB", "GB", "TB", "PB", "EB", "ZB"}
-	byteSize := int64(0)
-	kilo := 1024.0
-	re := regexp.MustCompile("[A-z]+")
-	unit := strings.ToUpper(re.FindString(size))
-	number, _ := strings.CutSuffix(size, unit)
+// ParseByteSize parses sizes like 512, 25KB, 1.5gb or -1B, units are case-insensitive powers of 1024.
+func ParseByteSize(size string) (int64, error) {
+	match := byteSizeExpression.FindStringSubmatch(size)
+	if match == nil {
+		return 0, fmt.Errorf("%w %q: a number with an optional unit is expected, e.g. 25KB or 1.5GB", ErrInvalidByteSize, size)
+	}
 
-	sizeValue, err := strconv.Atoi(number)
+	number, err := strconv.ParseFloat(match[1], 64)
 	if err != nil {
-		panic(err)
+		return 0, fmt.Errorf("%w %q: %w", ErrInvalidByteSize, size, err)
 	}
 
-	for i, v := range coefficients {
-		if v == unit || i == 0 && unit == "B" {
-			byteSize = int64(sizeValue) * int64(math.Pow(kilo, float64(i)))
-		}
+	unit := strings.ToUpper(match[2])
+	if unit == "" {
+		unit = byteSizeUnits[0]
+	}
+
+	power := slices.Index(byteSizeUnits, unit)
+	if power == -1 {
+		return 0, fmt.Errorf(
+			"%w %q: unknown unit %q, expected one of %s",
+			ErrInvalidByteSize,
+			size,
+			match[2],
+			strings.Join(byteSizeUnits, ", "),
+		)
+	}
+
+	byteSize := number * math.Pow(kilo, float64(power))
+	if math.Abs(byteSize) >= math.MaxInt64 {
+		return 0, fmt.Errorf("%w %q: it's too large", ErrInvalidByteSize, size)
 	}
 
-	return byteSize
+	return int64(byteSize), nil
 }
@@ -16,3 +16,26 @@ func TestPrettyByteSize(t *testing.T) {
 	size = 1024*1024*1024 + 1024*30 + 7
 	require.Equal(t, "1GB", PrettyByteSize(size))
 }
+
+func TestParseByteSize(t *testing.T) {
+	t.Parallel()
+
+	for value, expected := range map[string]int64{
+		"512":    512,
+		"-1B":    -1,
+		"25KB":   25 * 1024,
+		"10mb":   10 * 1024 * 1024,
+		"1.5GB":  1024 * 1024 * 1024 * 3 / 2,
+		" 2 gb ": 2 * 1024 * 1024 * 1024,
+		"0.5kb":  512,
+	} {
+		size, err := ParseByteSize(value)
+		require.NoError(t, err, value)
+		require.Equal(t, expected, size, value)
+	}
+
+	for _, value := range []string{"", "MB", "10XB", "10 mib", "1.5.5GB", "9EB", "ten"} {
+		_, err := ParseByteSize(value)
+		require.ErrorIs(t, err, ErrInvalidByteSize, value)
+	}
+}
@@ -0,0 +1,95 @@
+package ignore
+
+import (
+	"errors"
+	"io/fs"
+	"log/slog"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"sync"
+)
+
+// FileName is the name of ignore files, they can be put in any folder of the data folder.
+const FileName = ".tinytuneignore"
+
+// Matcher matches paths against the default rules and rules of ignore files found in the folders above them.
+// Ignore files are read once, when a path in their folder is matched first.
+type Matcher struct {
+	root     string
+	defaults *Rules
+	mu       sync.Mutex
+	// rules by folder path relative to the root, nil if the folder has no ignore file
+	rules map[string]*Rules
+}
+
+func NewMatcher(root string, defaults *Rules) *Matcher {
+	return &Matcher{
+		root:     root,
+		defaults: defaults,
+		rules:    map[string]*Rules{},
+	}
+}
+
+// Ignored reports whether the path relative to the root is ignored,
+// folders above it are expected not to be ignored, they are skipped by walkers.
+func (m *Matcher) Ignored(relativePath string, isDir bool) bool {
+	slashPath := filepath.ToSlash(relativePath)
+	segments := strings.Split(slashPath, "/")
+	ignored, _ := m.defaults.Match(slashPath, isDir)
+	dir := "."
+
+	// rules of deeper folders take precedence
+	for i := range segments {
+		if rules := m.rulesOf(dir); rules != nil {
+			if rulesIgnored, ok := rules.Match(strings.Join(segments[i:], "/"), isDir); ok {
+				ignored = rulesIgnored
+			}
+		}
+
+		dir = path.Join(dir, segments[i])
+	}
+
+	return ignored
+}
+
+// Forget drops rules of the folder, so its ignore file is read again, e.g. after it's changed.
+func (m *Matcher) Forget(dir string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	delete(m.rules, filepath.ToSlash(dir))
+}
+
+func (m *Matcher) rulesOf(dir string) *Rules {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if rules, ok := m.rules[dir]; ok {
+		return rules
+	}
+
+	rules, err := m.read(dir)
+	if err != nil {
+		slog.Warn("Failed to read the ignore file", slog.String("dir", dir), slog.String("error", err.Error()))
+	}
+
+	m.rules[dir] = rules
+
+	return rules
+}
+
+func (m *Matcher) read(dir string) (*Rules, error) {
+	file, err := os.Open(filepath.Join(m.root, filepath.FromSlash(dir), FileName))
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, nil //nolint:nilnil
+	}
+
+	if err != nil {
+		return nil, err //nolint:wrapcheck
+	}
+	defer file.Close()
+
+	return Parse(file)
+}
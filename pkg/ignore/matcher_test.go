@@ -0,0 +1,37 @@
+package ignore
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestMatcher(t *testing.T) {
+	t.Parallel()
+	require := require.New(t)
+
+	root := t.TempDir()
+	require.NoError(os.MkdirAll(filepath.Join(root, "a", "b"), 0o755))
+	require.NoError(os.WriteFile(filepath.Join(root, FileName), []byte("*.tmp\n!.well-known\n"), 0o600))
+	require.NoError(os.WriteFile(filepath.Join(root, "a", FileName), []byte("!keep.tmp\n/skip.jpg\n"), 0o600))
+
+	matcher := NewMatcher(root, Defaults())
+
+	require.True(matcher.Ignored(".DS_Store", false))
+	require.False(matcher.Ignored(".well-known", true))
+	require.True(matcher.Ignored("x.tmp", false))
+	require.True(matcher.Ignored(filepath.Join("a", "b", "x.tmp"), false))
+	// rules of the deeper folder take precedence
+	require.False(matcher.Ignored(filepath.Join("a", "keep.tmp"), false))
+	require.True(matcher.Ignored(filepath.Join("a", "skip.jpg"), false))
+	require.False(matcher.Ignored(filepath.Join("a", "b", "skip.jpg"), false))
+	require.False(matcher.Ignored("skip.jpg", false))
+
+	// the changed ignore file is read again after the folder is forgotten
+	require.NoError(os.WriteFile(filepath.Join(root, "a", FileName), []byte(""), 0o600))
+	require.True(matcher.Ignored(filepath.Join("a", "skip.jpg"), false))
+	matcher.Forget("a")
+	require.False(matcher.Ignored(filepath.Join("a", "skip.jpg"), false))
+}
@@ -0,0 +1,153 @@
+package ignore
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"path"
+	"strings"
+)
+
+var ErrRulesRead = errors.New("failed to read ignore rules")
+
+// pattern is one line of the ignore file, it's split by "/" into globs of path segments.
+type pattern struct {
+	segments []string
+	negate   bool
+	dirOnly  bool
+}
+
+// Rules are patterns of one ignore file, they match paths relative to its folder
+// the same way as .gitignore does: the last matching pattern decides, "!" includes the path back.
+type Rules struct {
+	patterns []pattern
+}
+
+func New(lines ...string) *Rules {
+	rules := &Rules{}
+
+	for _, line := range lines {
+		if p, ok := parsePattern(line); ok {
+			rules.patterns = append(rules.patterns, p)
+		}
+	}
+
+	return rules
+}
+
+// Parse reads rules of the ignore file.
+func Parse(r io.Reader) (*Rules, error) {
+	lines := []string{}
+	scanner := bufio.NewScanner(r)
+
+	for scanner.Scan() {
+		lines = append(lines, scanner.Text())
+	}
+
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrRulesRead, err)
+	}
+
+	return New(lines...), nil
+}
+
+// Defaults hides dotfiles and junk files of file managers and NAS systems.
+func Defaults() *Rules {
+	return New(".*", "Thumbs.db", "@eaDir")
+}
+
+func parsePattern(line string) (pattern, bool) {
+	line = strings.TrimSuffix(line, "\r")
+
+	// trailing spaces are ignored, unless they are escaped
+	for strings.HasSuffix(line, " ") && !strings.HasSuffix(line, "\\ ") {
+		line = line[:len(line)-1]
+	}
+
+	if line == "" || strings.HasPrefix(line, "#") {
+		return pattern{}, false
+	}
+
+	p := pattern{}
+
+	switch {
+	case strings.HasPrefix(line, "!"):
+		p.negate = true
+		line = line[1:]
+	case strings.HasPrefix(line, "\\!"), strings.HasPrefix(line, "\\#"):
+		line = line[1:]
+	}
+
+	if strings.HasSuffix(line, "/") {
+		p.dirOnly = true
+		line = strings.TrimRight(line, "/")
+	}
+
+	if line == "" {
+		return pattern{}, false
+	}
+
+	// the pattern without a slash matches the name at any level, otherwise the path from the folder of the rules
+	anchored := strings.Contains(line, "/")
+	p.segments = strings.Split(strings.TrimPrefix(line, "/"), "/")
+
+	if !anchored {
+		p.segments = append([]string{"**"}, p.segments...)
+	}
+
+	return p, true
+}
+
+// Match reports whether the path (slash separated, relative to the folder of the rules) is ignored,
+// matched is false if no pattern matches it.
+func (r *Rules) Match(path string, isDir bool) (bool, bool) {
+	segments := strings.Split(path, "/")
+
+	for i := len(r.patterns) - 1; i >= 0; i-- {
+		p := r.patterns[i]
+		if p.dirOnly && !isDir {
+			continue
+		}
+
+		if matchSegments(p.segments, segments) {
+			return !p.negate, true
+		}
+	}
+
+	return false, false
+}
+
+// matchSegments matches the path segments by globs, "**" matches any count of segments.
+func matchSegments(globs []string, segments []string) bool {
+	for len(globs) != 0 {
+		if globs[0] == "**" {
+			rest := globs[1:]
+
+			// the trailing "**" matches everything inside the folder, but not the folder
+			if len(rest) == 0 {
+				return len(segments) != 0
+			}
+
+			for i := range len(segments) + 1 {
+				if matchSegments(rest, segments[i:]) {
+					return true
+				}
+			}
+
+			return false
+		}
+
+		if len(segments) == 0 {
+			return false
+		}
+
+		if ok, err := path.Match(globs[0], segments[0]); err != nil || !ok {
+			return false
+		}
+
+		globs, segments = globs[1:], segments[1:]
+	}
+
+	return len(segments) == 0
+}
@@ -0,0 +1,65 @@
+package ignore
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRulesMatch(t *testing.T) {
+	t.Parallel()
+
+	rules, err := Parse(strings.NewReader(`# comment
+*.tmp
+!keep.tmp
+/top.jpg
+cache/
+docs/*.txt
+raw/**/*.cr2
+trailing  
+\#hash
+`))
+	require.NoError(t, err)
+
+	cases := []struct {
+		path    string
+		isDir   bool
+		ignored bool
+		matched bool
+	}{
+		{path: "a.tmp", ignored: true, matched: true},
+		{path: "deep/dir/a.tmp", ignored: true, matched: true},
+		{path: "keep.tmp", ignored: false, matched: true},
+		{path: "top.jpg", ignored: true, matched: true},
+		{path: "sub/top.jpg", ignored: false, matched: false},
+		{path: "cache", isDir: true, ignored: true, matched: true},
+		{path: "cache", ignored: false, matched: false},
+		{path: "docs/a.txt", ignored: true, matched: true},
+		{path: "docs/sub/a.txt", ignored: false, matched: false},
+		{path: "raw/a.cr2", ignored: true, matched: true},
+		{path: "raw/2024/05/a.cr2", ignored: true, matched: true},
+		{path: "trailing", ignored: true, matched: true},
+		{path: "#hash", ignored: true, matched: true},
+		{path: "image.jpg", ignored: false, matched: false},
+	}
+
+	for _, c := range cases {
+		ignored, matched := rules.Match(c.path, c.isDir)
+		assert.Equal(t, c.ignored, ignored, c.path)
+		assert.Equal(t, c.matched, matched, c.path)
+	}
+}
+
+func TestDefaults(t *testing.T) {
+	t.Parallel()
+
+	for _, path := range []string{".DS_Store", "a/.hidden", "Thumbs.db", "@eaDir"} {
+		ignored, _ := Defaults().Match(path, false)
+		assert.True(t, ignored, path)
+	}
+
+	ignored, _ := Defaults().Match("image.jpg", false)
+	assert.False(t, ignored)
+}
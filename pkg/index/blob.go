@@ -0,0 +1,100 @@
+package index
+
+import (
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+)
+
+var (
+	ErrLazySource    = errors.New("index source can't be read lazily")
+	ErrReadPreview   = errors.New("failed to read preview")
+	ErrSourceSeeking = errors.New("failed to seek index source")
+)
+
+// lazySource is an index file, which previews part is read on demand.
+type lazySource interface {
+	io.ReaderAt
+	io.Seeker
+}
+
+// blobSource is the previews part of the index file, which stays on disk.
+// Previews generated after decoding are appended to Index.data, so preview's offsets
+// continue after the source part.
+type blobSource struct {
+	reader io.ReaderAt
+	offset int64
+	size   uint64
+	// header of the file, saves append previews to files of the current version
+	header header
+}
+
+func (index *Index) blobSize() uint64 {
+	return index.source.size + uint64(len(index.data))
+}
+
+func (index *Index) appendPreview(data []byte) PreviewLocation {
+	location := PreviewLocation{
+		Offset:   index.blobSize(),
+		Length:   uint64(len(data)),
+		Checksum: crc32.ChecksumIEEE(data),
+	}
+	index.data = append(index.data, data...)
+
+	return location
+}
+
+func (index *Index) readPreview(location PreviewLocation) ([]byte, error) {
+	if location.Offset+location.Length > index.blobSize() {
+		return nil, fmt.Errorf("%w: out of range", ErrReadPreview)
+	}
+
+	if location.Offset >= index.source.size {
+		offset := location.Offset - index.source.size
+
+		return index.data[offset : offset+location.Length], nil
+	}
+
+	buffer := make([]byte, location.Length)
+	if _, err := index.source.reader.ReadAt(buffer, index.source.offset+int64(location.Offset)); err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrReadPreview, err)
+	}
+
+	return buffer, nil
+}
+
+// Verify compares previews with their checksums, returns items which previews are corrupted.
+func (index *Index) Verify() []*Meta {
+	index.mu.RLock()
+	defer index.mu.RUnlock()
+
+	corrupted := []*Meta{}
+
+	for _, m := range index.meta {
+		if m.Preview.Length == 0 {
+			continue
+		}
+
+		data, err := index.readPreview(m.Preview)
+		if err != nil || crc32.ChecksumIEEE(data) != m.Preview.Checksum {
+			corrupted = append(corrupted, m)
+		}
+	}
+
+	return corrupted
+}
+
+// DropPreviews removes previews of the items, so they are produced again at the next indexing.
+func (index *Index) DropPreviews(items []*Meta) {
+	index.mu.Lock()
+	defer index.mu.Unlock()
+
+	for _, m := range items {
+		updated := *m
+		updated.Preview = PreviewLocation{}
+		index.put(&updated)
+	}
+
+	index.outDated = true
+}
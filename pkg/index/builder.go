@@ -6,40 +6,51 @@ import (
 	"fmt"
 	"io"
 	"log/slog"
-	"path/filepath"
 	"sync"
 
 	"github.com/alxarno/tinytune/pkg/preview"
-	"golang.org/x/sync/semaphore"
 )
 
 var (
-	ErrSemaphoreAcquire = errors.New("failed to acquire the semaphore")
-	ErrFileLoad         = errors.New("failed to load file")
-	ErrPreviewPull      = errors.New("failed to preview")
+	ErrWorkerAcquire = errors.New("failed to acquire a worker")
+	ErrFileLoad      = errors.New("failed to load file")
+	ErrPreviewPull   = errors.New("failed to preview")
+	ErrProbe         = errors.New("failed to probe")
+	ErrScan          = errors.New("failed to scan files")
 )
 
+// PreviewGenerator produces previews, it isn't closed by the index,
+// since it's used for updates after the index is built.
+// Probe is expected to be fast, media information of all files is probed before previews are produced.
 type PreviewGenerator interface {
+	Probe(ctx context.Context, item preview.Source) (preview.Probe, error)
 	Pull(ctx context.Context, item preview.Source) (preview.Data, error)
-	Close()
 }
 
 type indexBuilderParams struct {
 	preview           PreviewGenerator
 	files             []FileMeta
+	scan              func(decoded *Index) ([]FileMeta, error)
 	progress          func()
 	newFiles          func()
 	workers           int
 	cleanRemovedFiles bool
+	contentIdentity   bool
+	lazy              bool
+	background        bool
+	retryFailed       bool
+	checkpoint        checkpointParams
 }
 
 type indexBuilder struct {
-	index  *Index
-	params indexBuilderParams
+	index      *Index
+	params     indexBuilderParams
+	ids        *idClaims
+	checkpoint *checkpoint
 }
 
-func newBuilder(index *Index) indexBuilder {
-	return indexBuilder{index: index, params: indexBuilderParams{
+func newBuilder(index *Index) *indexBuilder {
+	return &indexBuilder{index: index, params: indexBuilderParams{
 		files:    []FileMeta{},
 		progress: func() {},
 		newFiles: func() {},
@@ -48,40 +59,127 @@ func newBuilder(index *Index) indexBuilder {
 }
 
 func (ib *indexBuilder) run(ctx context.Context, r io.Reader) error {
-	if err := ib.index.Decode(r); err != nil {
-		if !errors.Is(err, io.EOF) {
-			return err
-		}
+	ib.index.updating.Lock()
 
-		slog.Warn("The index file could not be fully read, it may be corrupted or empty")
+	ib.checkpoint = newCheckpoint(ib.params.checkpoint)
+
+	if err := ib.start(r); err != nil {
+		ib.index.updating.Unlock()
+		ib.index.finish(err)
+
+		return err
 	}
 
-	if ib.params.cleanRemovedFiles {
-		ib.clearRemovedFiles()
+	ctx, done := ib.index.cancelable(ctx)
+
+	if ib.params.background {
+		go func() { _ = ib.build(ctx, done) }()
+
+		return nil
 	}
 
-	if err := ib.loadPaths(); err != nil {
+	return ib.build(ctx, done)
+}
+
+// start prepares the index and lists the files to load by the scan, if it's given.
+func (ib *indexBuilder) start(r io.Reader) error {
+	if err := ib.prepare(r); err != nil {
 		return err
 	}
 
-	if err := ib.loadFiles(ctx); err != nil {
-		return err
+	if ib.params.scan == nil {
+		return nil
 	}
 
-	if ib.params.preview != nil {
-		ib.params.preview.Close()
+	files, err := ib.params.scan(ib.index)
+	if err != nil {
+		return fmt.Errorf("%w: %w", ErrScan, err)
+	}
+
+	ib.params.files = files
+
+	return nil
+}
+
+// build loads the files into the prepared index and releases it for updates.
+func (ib *indexBuilder) build(ctx context.Context, done func()) error {
+	defer ib.index.updating.Unlock()
+	defer done()
+
+	err := ib.load(ctx)
+	if err != nil && ib.params.background {
+		slog.Error(fmt.Errorf("%w: %w", ErrFileLoad, err).Error())
 	}
 
-	if err := ib.loadTree(); err != nil {
+	ib.index.finish(err)
+
+	return err
+}
+
+func (ib *indexBuilder) load(ctx context.Context) error {
+	scanned := make(map[RelativePath]struct{}, len(ib.params.files))
+	for _, file := range ib.params.files {
+		scanned[RelativePath(file.RelativePath())] = struct{}{}
+	}
+
+	pending := ib.pendingFiles(ib.params.files, func(path RelativePath) bool {
+		_, ok := scanned[path]
+
+		return ok
+	})
+
+	if err := ib.loadFiles(ctx, pending); err != nil {
 		return err
 	}
 
-	// load second time for new meta items
+	ib.index.mu.Lock()
+	defer ib.index.mu.Unlock()
+
+	// removed files are cleaned after loading, so moved ones keep their items
+	if ib.params.cleanRemovedFiles {
+		ib.clearRemovedFiles()
+	}
+
+	// previews of removed and replaced files are dropped in one pass
+	return ib.index.compactData()
+}
+
+// prepare decodes the index and builds its tree, so it can be read while the files are loaded.
+func (ib *indexBuilder) prepare(r io.Reader) error {
+	ib.index.mu.Lock()
+	defer ib.index.mu.Unlock()
+
+	if err := ib.decode(r); err != nil {
+		if !errors.Is(err, io.EOF) && !errors.Is(err, io.ErrUnexpectedEOF) {
+			return err
+		}
+
+		slog.Warn("The index file could not be fully read, it may be corrupted or empty")
+	}
+
 	if err := ib.loadPaths(); err != nil {
 		return err
 	}
 
-	return nil
+	return ib.loadTree()
+}
+
+func (ib *indexBuilder) decode(r io.Reader) error {
+	if !ib.params.lazy || r == nil {
+		return ib.index.Decode(r)
+	}
+
+	source, ok := r.(lazySource)
+	if !ok {
+		return ErrLazySource
+	}
+
+	size, err := source.Seek(0, io.SeekEnd)
+	if err != nil {
+		return fmt.Errorf("%w: %w", ErrSourceSeeking, err)
+	}
+
+	return ib.index.DecodeLazy(source, size)
 }
 
 type loadedFile struct {
@@ -89,131 +187,333 @@ type loadedFile struct {
 	data []byte
 }
 
-//nolint:cyclop
-func (ib *indexBuilder) loadFile(
-	ctx context.Context,
-	wg *sync.WaitGroup,
-	sem *semaphore.Weighted,
-	file FileMeta,
-	dst chan loadedFile,
-) error {
-	metaItem := metaByFile(file)
+// pendingFiles returns items of the files, which have to be loaded into the index,
+// exists reports whether the file at the path still exists.
+// The new files are listed in the index without previews until they are loaded.
+func (ib *indexBuilder) pendingFiles(files []FileMeta, exists func(path RelativePath) bool) []*Meta {
+	ib.index.mu.Lock()
+	pending := make([]*Meta, 0)
+	pendingMeta := ib.pendingMeta
+	hash := func(*Meta) {}
+	ib.ids = newIDClaims(ib.index)
+	ib.index.progress.Total += len(files)
+
+	if ib.params.contentIdentity {
+		identity := newContentIdentity(ib.index, exists, ib.ids, ib.postponed)
+		pendingMeta = identity.pendingMeta
+		hash = identity.hash
+	}
+
+	ib.index.mu.Unlock()
+
+	// files are hashed before the index is locked, so it's read while they are hashed
+	for _, file := range files {
+		metaItem := metaByFile(file)
+		hash(metaItem)
+
+		ib.index.mu.Lock()
+		metaItem = pendingMeta(metaItem)
+
+		if metaItem != nil {
+			ib.index.list(metaItem)
+		} else {
+			ib.index.progress.Done++
+		}
+
+		ib.index.mu.Unlock()
+
+		if metaItem != nil {
+			pending = append(pending, metaItem)
+
+			continue
+		}
+
+		ib.params.progress()
+	}
+
+	return pending
+}
+
+// pendingMeta returns meta of the file, which has to be loaded into the index,
+// or nil if the index already has it.
+// The modified file/folder has the same path, but other id, its old version is replaced after loading.
+func (ib *indexBuilder) pendingMeta(metaItem *Meta) *Meta {
+	ib.ids.resolve(metaItem)
 
 	// if item already in map, but without preview -> create preview
 	shouldSkipPreview := metaItem.IsDir || metaItem.IsOtherFile()
-	if saved, ok := ib.index.meta[metaItem.ID]; ok && (saved.Preview.Length != 0 || shouldSkipPreview) {
+	saved, ok := ib.index.meta[metaItem.ID]
+
+	if ok && (saved.Preview.Length != 0 || shouldSkipPreview || ib.postponed(saved)) {
 		return nil
 	}
 
-	// needs for check if file/folder was modified, and remove old version
-	// same path, but different ids
-	if oldMeta, ok := ib.index.paths[metaItem.RelativePath]; ok {
-		delete(ib.index.meta, oldMeta.ID)
+	if ok {
+		metaItem.Failure = saved.Failure
 	}
 
-	if ib.params.preview == nil || metaItem.IsDir {
-		dst <- loadedFile{metaItem, nil}
+	ib.ids.claim(metaItem)
 
-		return nil
-	}
+	return metaItem
+}
 
-	if err := sem.Acquire(ctx, 1); err != nil {
-		if errors.Is(err, context.Canceled) {
-			return nil
-		}
+// loadFunc loads the item, it returns its loaded copy.
+type loadFunc func(ctx context.Context, metaItem *Meta) loadedFile
 
-		return fmt.Errorf("%w: %w", ErrSemaphoreAcquire, err)
+// loadFiles loads the files in two passes: media information of all files is probed first,
+// so listings are complete early, then previews are produced.
+// The probed information is kept, if the preview fails.
+func (ib *indexBuilder) loadFiles(ctx context.Context, pending []*Meta) error {
+	pending, shared := ib.sharedFiles(pending)
+	probed := make([]*Meta, 0, len(pending))
+
+	err := ib.runPass(ctx, pending, ib.probeFile, func(result loadedFile) {
+		ib.index.mu.Lock()
+		ib.index.put(result.meta)
+		ib.index.outDated = true
+		ib.index.mu.Unlock()
+
+		probed = append(probed, result.meta)
+	})
+	if err != nil {
+		return err
 	}
 
-	wg.Add(1)
+	if err := ib.runPass(ctx, probed, ib.previewFile, ib.mergeFile); err != nil {
+		return err
+	}
 
-	go func() {
-		defer sem.Release(1)
-		defer wg.Done()
+	ib.shareFiles(shared)
 
-		preview, err := ib.params.preview.Pull(ctx, metaItem)
-		if err != nil {
-			slog.Error(fmt.Errorf("%w (%s): %w", ErrPreviewPull, metaItem.RelativePath, err).Error())
-			dst <- loadedFile{metaItem, nil}
+	return nil
+}
 
-			return
+// sharedFiles splits the items into the ones to load and the ones, which real path is loaded by another item,
+// so a file reached through several symbolic links is processed once.
+func (ib *indexBuilder) sharedFiles(pending []*Meta) ([]*Meta, []*Meta) {
+	ib.index.mu.RLock()
+	loaded := ib.index.realPaths()
+	ib.index.mu.RUnlock()
+
+	load := make([]*Meta, 0, len(pending))
+	shared := make([]*Meta, 0)
+	loading := make(map[string]*Meta)
+
+	for _, m := range pending {
+		if m.RealPath == "" || m.IsDir {
+			load = append(load, m)
+
+			continue
 		}
 
-		metaItem.Duration = preview.Duration()
-		width, height := preview.Resolution()
-		metaItem.Resolution.Width = width
-		metaItem.Resolution.Height = height
-		metaItem.Preview = PreviewLocation{
-			Length: uint32(len(preview.Data())),
+		if source, ok := loaded[m.RealPath]; ok && source.sameFile(m) {
+			shared = append(shared, m)
+
+			continue
 		}
 
-		dst <- loadedFile{metaItem, preview.Data()}
+		if source, ok := loading[m.RealPath]; ok && source.sameFile(m) {
+			shared = append(shared, m)
+
+			continue
+		}
+
+		loading[m.RealPath] = m
+		load = append(load, m)
+	}
+
+	return load, shared
+}
+
+// shareFiles gives the items previews and media information of the loaded items with the same real path.
+func (ib *indexBuilder) shareFiles(shared []*Meta) {
+	ib.index.mu.Lock()
+	loaded := ib.index.realPaths()
+
+	for _, m := range shared {
+		if source, ok := loaded[m.RealPath]; ok && source.sameFile(m) {
+			copied := *m
+			copied.Preview = source.Preview
+			copied.Duration = source.Duration
+			copied.Resolution = source.Resolution
+			copied.Codec = source.Codec
+			copied.Failure = source.Failure
+
+			ib.index.put(&copied)
+			ib.index.outDated = true
+		}
+
+		ib.index.progress.Done++
+	}
+
+	ib.index.mu.Unlock()
+
+	for range shared {
+		ib.params.progress()
+	}
+}
+
+func (ib *indexBuilder) runPass(ctx context.Context, items []*Meta, load loadFunc, merge func(loadedFile)) error {
+	results := make(chan loadedFile, ib.params.workers)
+	merged := make(chan struct{})
+
+	go func() {
+		defer close(merged)
+
+		for result := range results {
+			merge(result)
+		}
 	}()
 
-	return nil
+	err := ib.dispatchFiles(ctx, items, load, results)
+
+	close(results)
+	<-merged
+
+	return err
 }
 
-func (ib *indexBuilder) loadFiles(ctx context.Context) error {
+func (ib *indexBuilder) dispatchFiles(ctx context.Context, items []*Meta, load loadFunc, dst chan loadedFile) error {
 	wg := new(sync.WaitGroup)
-	sem := semaphore.NewWeighted(int64(ib.params.workers))
-	results := make(chan loadedFile, len(ib.params.files))
+	defer wg.Wait()
 
-	for _, file := range ib.params.files {
-		ib.params.progress()
+	queue := newLoadQueue(items, ib.index.priorities)
 
-		err := ib.loadFile(ctx, wg, sem, file, results)
+	// items are taken from the queue when a worker is free, so folders opened meanwhile go first
+	for metaItem, ok := queue.pop(); ok; metaItem, ok = queue.pop() {
+		err := ib.loadFile(ctx, wg, metaItem, load, dst)
 		if err != nil {
 			return fmt.Errorf("%w: %w", ErrFileLoad, err)
 		}
 	}
 
-	wg.Wait()
-	close(results)
+	return nil
+}
+
+func (ib *indexBuilder) loadFile(
+	ctx context.Context,
+	wg *sync.WaitGroup,
+	metaItem *Meta,
+	load loadFunc,
+	dst chan loadedFile,
+) error {
+	if ib.params.preview == nil || metaItem.IsDir {
+		dst <- loadedFile{metaItem, nil}
 
-	for result := range results {
-		ib.params.newFiles()
+		return nil
+	}
 
-		if result.meta.Preview.Length != 0 {
-			result.meta.Preview.Offset = uint32(len(ib.index.data))
-			ib.index.data = append(ib.index.data, result.data...)
+	if err := ib.index.pool.acquire(ctx); err != nil {
+		if errors.Is(err, context.Canceled) {
+			return nil
 		}
 
-		ib.index.meta[result.meta.ID] = result.meta
-		ib.index.outDated = true
+		return fmt.Errorf("%w: %w", ErrWorkerAcquire, err)
 	}
 
+	wg.Add(1)
+
+	go func() {
+		defer ib.index.pool.release()
+		defer wg.Done()
+
+		dst <- load(ctx, metaItem)
+	}()
+
 	return nil
 }
 
-func (ib *indexBuilder) loadTree() error {
-	upperDir := func(path RelativePath) RelativePath {
-		return RelativePath(filepath.Dir(string(path)))
+func (ib *indexBuilder) probeFile(ctx context.Context, metaItem *Meta) loadedFile {
+	probed := *metaItem
+
+	probe, err := ib.params.preview.Probe(ctx, metaItem)
+	if err != nil {
+		slog.Warn(fmt.Errorf("%w (%s): %w", ErrProbe, metaItem.RelativePath, err).Error())
+
+		return loadedFile{&probed, nil}
 	}
-	rootChildren := make([]*Meta, 0)
 
-	for _, subRoot := range ib.index.meta {
-		if upperDir(subRoot.RelativePath) == "." {
-			rootChildren = append(rootChildren, subRoot)
-		}
+	probed.Duration = probe.Duration()
+	probed.Resolution.Width, probed.Resolution.Height = probe.Resolution()
+	probed.Codec = probe.Codec()
 
-		if !subRoot.IsDir {
-			continue
+	return loadedFile{&probed, nil}
+}
+
+func (ib *indexBuilder) previewFile(ctx context.Context, metaItem *Meta) loadedFile {
+	preview, err := ib.params.preview.Pull(ctx, metaItem)
+	if err != nil {
+		// the interrupted processing isn't a failure of the file
+		if ctx.Err() != nil {
+			return loadedFile{metaItem, nil}
 		}
 
-		subRootChildren := make([]*Meta, 0)
+		slog.Error(fmt.Errorf("%w (%s): %w", ErrPreviewPull, metaItem.RelativePath, err).Error())
 
-		for _, possibleChild := range ib.index.meta {
-			if subRoot.RelativePath == upperDir(possibleChild.RelativePath) {
-				subRootChildren = append(subRootChildren, possibleChild)
-			}
-		}
+		failed := *metaItem
+		failed.Failure = newFailure(metaItem.Failure, err)
+
+		return loadedFile{&failed, nil}
+	}
+
+	loaded := *metaItem
+	loaded.Failure = nil
+
+	// the probed information is preferred, e.g. the resolution of images is the original one
+	if loaded.Duration == 0 {
+		loaded.Duration = preview.Duration()
+	}
+
+	if loaded.Resolution.Width == 0 {
+		loaded.Resolution.Width, loaded.Resolution.Height = preview.Resolution()
+	}
+
+	loaded.Preview = PreviewLocation{
+		Length: uint64(len(preview.Data())),
+	}
 
-		if len(subRootChildren) != 0 {
-			ib.index.tree[subRoot.ID] = subRootChildren
+	return loadedFile{&loaded, preview.Data()}
+}
+
+func (ib *indexBuilder) mergeFile(result loadedFile) {
+	ib.params.progress()
+	ib.params.newFiles()
+	ib.index.mu.Lock()
+
+	if result.meta.Preview.Length != 0 {
+		result.meta.Preview = ib.index.appendPreview(result.data)
+	}
+
+	ib.index.put(result.meta)
+	ib.index.outDated = true
+	ib.index.progress.Done++
+	ib.index.mu.Unlock()
+
+	if result.meta.Preview.Length != 0 {
+		ib.checkpoint.previewAdded(ib.index)
+	}
+}
+
+func (ib *indexBuilder) loadTree() error {
+	children := make(map[RelativePath][]*Meta, len(ib.index.paths))
+
+	for _, m := range ib.index.meta {
+		parent := parentPath(m.RelativePath)
+		children[parent] = append(children[parent], m)
+	}
+
+	ib.index.tree = make(map[ID][]*Meta, len(children))
+
+	for path, items := range children {
+		if dir, ok := ib.index.paths[path]; ok && dir.IsDir {
+			ib.index.tree[dir.ID] = items
 		}
 	}
 
-	ib.index.tree["root"] = rootChildren
+	ib.index.tree[rootID] = children["."]
+	if ib.index.tree[rootID] == nil {
+		ib.index.tree[rootID] = []*Meta{}
+	}
 
 	return nil
 }
@@ -233,25 +533,10 @@ func (ib *indexBuilder) clearRemovedFiles() {
 		exist[RelativePath(f.RelativePath())] = struct{}{}
 	}
 
-	for key, m := range ib.index.meta {
-		if _, ok := exist[m.RelativePath]; !ok {
-			if m.Preview.Length != 0 {
-				ib.clearPreview(m.Preview.Offset, m.Preview.Length)
-			}
-
-			delete(ib.index.meta, key)
-		}
-	}
-}
-
-func (ib *indexBuilder) clearPreview(offset uint32, length uint32) {
-	shifted := ib.index.data[offset+length:]
-	ib.index.data = ib.index.data[:offset]
-	ib.index.data = append(ib.index.data, shifted...)
-
 	for _, m := range ib.index.meta {
-		if m.Preview.Length != 0 && m.Preview.Offset > offset {
-			m.Preview.Offset -= length
+		if _, ok := exist[m.RelativePath]; !ok {
+			ib.index.drop(m)
+			ib.index.outDated = true
 		}
 	}
 }
@@ -1,15 +1,23 @@
 package index
 
 import (
+	"bytes"
 	"context"
 	"crypto/sha256"
 	"encoding/hex"
+	"fmt"
+	"io"
+	"io/fs"
+	"maps"
 	"os"
 	"path/filepath"
+	"slices"
 	"strings"
+	"sync/atomic"
 	"testing"
 	"time"
 
+	"github.com/alxarno/tinytune/pkg/preview"
 	"github.com/stretchr/testify/require"
 )
 
@@ -22,6 +30,8 @@ func TestIndexBuilder(t *testing.T) {
 	index, err := NewIndex(context.Background(), indexFile)
 	require.NoError(err)
 	require.Len(index.meta, 17)
+	// legacy index file without version has to be migrated
+	require.True(index.OutDated())
 	sample, ok := index.meta["623f14247e"]
 	require.True(ok)
 	require.True(sample.IsVideo())
@@ -31,7 +41,7 @@ func TestIndexBuilder(t *testing.T) {
 	require.EqualValues(12534, sample.Preview.Length)
 	require.EqualValues(36234, sample.Preview.Offset)
 	require.EqualValues(7222114, sample.OriginSize)
-	require.LessOrEqual(sample.Preview.Offset+sample.Preview.Length, uint32(len(index.data)))
+	require.LessOrEqual(sample.Preview.Offset+sample.Preview.Length, uint64(len(index.data)))
 }
 
 func TestIndexBuilderClearRemovedFiles(t *testing.T) {
@@ -131,3 +141,575 @@ func TestIndexBuilderClearRemovedFiles(t *testing.T) {
 
 	require.Equal(itemNextPreviewDataHash, hex.EncodeToString(h.Sum(nil)))
 }
+
+func TestIndexBuilderCheckpoint(t *testing.T) {
+	t.Parallel()
+	require := require.New(t)
+
+	filesMeta := []FileMeta{}
+
+	for i := range 5 {
+		filesMeta = append(filesMeta, &mockFile{
+			path:         fmt.Sprintf("/home/test/%d.jpg", i),
+			relativePath: fmt.Sprintf("%d.jpg", i),
+			name:         fmt.Sprintf("%d.jpg", i),
+			modTime:      time.Date(2024, 11, 5, 5, 5, 5, 0, time.UTC),
+		})
+	}
+
+	sampleData := make([]byte, 10)
+	checkpoints := []*bytes.Buffer{}
+	index, err := NewIndex(
+		context.Background(),
+		nil,
+		WithFiles(filesMeta),
+		WithPreview(mockPreviewGenerator{sampleData: sampleData}),
+		WithWorkers(2),
+		WithCheckpoint(0, 2, func(index *Index) error {
+			buff := new(bytes.Buffer)
+			_, err := index.Encode(buff)
+			checkpoints = append(checkpoints, buff)
+
+			return err
+		}),
+	)
+	require.NoError(err)
+	require.Len(index.meta, 5)
+	require.Len(checkpoints, 2)
+
+	// the last checkpoint resumes the indexing, the files being processed are listed without previews
+	resumed, err := NewIndex(context.Background(), checkpoints[1])
+	require.NoError(err)
+	require.Len(resumed.meta, 5)
+	require.Len(resumed.data, 4*len(sampleData))
+
+	_, withPreview, _ := resumed.FilesWithPreviewStat()
+	require.Equal(4, withPreview)
+}
+
+func scanMockFiles(t *testing.T, root string) []FileMeta {
+	t.Helper()
+
+	files := []FileMeta{}
+	err := filepath.Walk(root, func(path string, info os.FileInfo, err error) error {
+		if err != nil || path == root {
+			return err
+		}
+
+		relativePath, err := filepath.Rel(root, path)
+		if err != nil {
+			return err
+		}
+
+		files = append(files, &mockFile{
+			path:         path,
+			relativePath: relativePath,
+			name:         info.Name(),
+			dir:          info.IsDir(),
+			modTime:      info.ModTime(),
+			size:         info.Size(),
+		})
+
+		return nil
+	})
+	require.NoError(t, err)
+
+	return files
+}
+
+func TestIndexBuilderContentIdentity(t *testing.T) {
+	t.Parallel()
+	require := require.New(t)
+
+	root := t.TempDir()
+	content := bytes.Repeat([]byte("tinytune"), 20000)
+	require.NoError(os.Mkdir(filepath.Join(root, "a"), fs.FileMode(dirRights)))
+	require.NoError(os.WriteFile(filepath.Join(root, "a", "x.jpg"), content, fs.FileMode(fileRights)))
+
+	sampleData := []byte("preview")
+	index, err := NewIndex(
+		context.Background(),
+		nil,
+		WithRoot(root),
+		WithContentIdentity(),
+		WithFiles(scanMockFiles(t, root)),
+		WithPreview(mockPreviewGenerator{sampleData: sampleData}),
+	)
+	require.NoError(err)
+
+	original := index.paths["a/x.jpg"]
+	require.NotNil(original)
+	require.NotEmpty(original.ContentHash)
+
+	buff := new(bytes.Buffer)
+	_, err = index.Encode(buff)
+	require.NoError(err)
+
+	// the file is moved into other folder, renamed and touched, the copy of it is added
+	require.NoError(os.Mkdir(filepath.Join(root, "b"), fs.FileMode(dirRights)))
+	require.NoError(os.Rename(filepath.Join(root, "a", "x.jpg"), filepath.Join(root, "b", "y.jpg")))
+	require.NoError(os.Chtimes(filepath.Join(root, "b", "y.jpg"), time.Now(), time.Now().Add(time.Hour)))
+	require.NoError(os.WriteFile(filepath.Join(root, "b", "z.jpg"), content, fs.FileMode(fileRights)))
+
+	moved, err := NewIndex(
+		context.Background(),
+		buff,
+		WithRoot(root),
+		WithContentIdentity(),
+		WithRemovedFilesCleaning(),
+		WithFiles(scanMockFiles(t, root)),
+		WithPreview(mockPreviewGenerator{sampleData: []byte("regenerated")}),
+	)
+	require.NoError(err)
+	require.Len(moved.meta, 4)
+	require.Nil(moved.paths["a/x.jpg"])
+
+	movedMeta := moved.paths["b/y.jpg"]
+	require.NotNil(movedMeta)
+	require.Equal(original.ID, movedMeta.ID)
+	require.Equal(filepath.Join(root, "b", "y.jpg"), movedMeta.Path())
+
+	data, err := moved.PullPreview(movedMeta.ID)
+	require.NoError(err)
+	require.Equal(sampleData, data)
+
+	copyMeta := moved.paths["b/z.jpg"]
+	require.NotNil(copyMeta)
+	require.NotEqual(original.ID, copyMeta.ID)
+	require.Equal(original.ContentHash, copyMeta.ContentHash)
+
+	data, err = moved.PullPreview(copyMeta.ID)
+	require.NoError(err)
+	require.Equal([]byte("regenerated"), data)
+}
+
+func TestIndexBuilderIDCollision(t *testing.T) {
+	t.Parallel()
+	require := require.New(t)
+
+	newFile := &mockFile{
+		path:         "/home/test/new.jpg",
+		relativePath: "new.jpg",
+		name:         "new.jpg",
+		modTime:      time.Date(2024, 11, 5, 5, 5, 5, 0, time.UTC),
+	}
+	collidingID := metaByFile(newFile).ID
+
+	indexOriginal, err := NewIndex(context.Background(), nil)
+	require.NoError(err)
+
+	indexOriginal.meta = map[ID]*Meta{
+		collidingID: {
+			ID:           collidingID,
+			Name:         "other.jpg",
+			RelativePath: "other.jpg",
+			ModTime:      time.Date(2024, 11, 5, 5, 5, 5, 0, time.UTC),
+			Type:         ContentTypeImage,
+			Preview:      PreviewLocation{Length: 10},
+		},
+	}
+	indexOriginal.data = make([]byte, 10)
+
+	buff := new(bytes.Buffer)
+	_, err = indexOriginal.Encode(buff)
+	require.NoError(err)
+
+	sampleData := make([]byte, 20)
+	index, err := NewIndex(
+		context.Background(),
+		buff,
+		WithFiles([]FileMeta{newFile}),
+		WithPreview(mockPreviewGenerator{sampleData: sampleData}),
+	)
+	require.NoError(err)
+	require.Len(index.meta, 2)
+	require.Equal(1, index.Collisions())
+	require.Equal("other.jpg", index.meta[collidingID].Name)
+
+	newMeta := index.paths["new.jpg"]
+	require.NotNil(newMeta)
+	require.Len(newMeta.ID, 2*(idSize+idExtensionSize))
+	require.True(strings.HasPrefix(string(newMeta.ID), string(collidingID)))
+
+	// the extended ID is kept, even after the colliding item is removed
+	buff = new(bytes.Buffer)
+	_, err = index.Encode(buff)
+	require.NoError(err)
+
+	index, err = NewIndex(
+		context.Background(),
+		buff,
+		WithFiles([]FileMeta{newFile}),
+		WithPreview(mockPreviewGenerator{sampleData: sampleData}),
+		WithRemovedFilesCleaning(),
+	)
+	require.NoError(err)
+	require.Len(index.meta, 1)
+	require.Zero(index.Collisions())
+	require.Equal(newMeta.ID, index.paths["new.jpg"].ID)
+	require.Len(index.data, len(sampleData))
+
+	// the file, which ID is extended several times, is counted once
+	extended := metaByFile(newFile)
+	require.True(extended.extendID())
+
+	indexOriginal.meta[extended.ID] = &Meta{
+		ID:           extended.ID,
+		Name:         "another.jpg",
+		RelativePath: "another.jpg",
+		Type:         ContentTypeImage,
+	}
+	buff = new(bytes.Buffer)
+	_, err = indexOriginal.Encode(buff)
+	require.NoError(err)
+
+	index, err = NewIndex(
+		context.Background(),
+		buff,
+		WithFiles([]FileMeta{newFile}),
+		WithPreview(mockPreviewGenerator{sampleData: sampleData}),
+	)
+	require.NoError(err)
+	require.Len(index.meta, 3)
+	require.Equal(1, index.Collisions())
+	require.Len(index.paths["new.jpg"].ID, 2*(idSize+2*idExtensionSize))
+}
+
+func TestIndexBuilderTree(t *testing.T) {
+	t.Parallel()
+	require := require.New(t)
+
+	modTime := time.Date(2024, 11, 5, 5, 5, 5, 0, time.UTC)
+	files := []FileMeta{}
+
+	for _, path := range []string{"a", "a/b", "a/b/c.jpg", "a/d.jpg", "e.jpg"} {
+		files = append(files, &mockFile{
+			relativePath: path,
+			name:         filepath.Base(path),
+			dir:          filepath.Ext(path) == "",
+			modTime:      modTime,
+		})
+	}
+
+	index, err := NewIndex(context.Background(), nil, WithFiles(files))
+	require.NoError(err)
+
+	childrenNames := func(path RelativePath) []string {
+		children, err := index.PullChildren(index.paths[path].ID)
+		require.NoError(err)
+
+		names := []string{}
+		for _, m := range children {
+			names = append(names, m.Name)
+		}
+
+		return names
+	}
+
+	require.ElementsMatch([]string{"b", "d.jpg"}, childrenNames("a"))
+	require.ElementsMatch([]string{"c.jpg"}, childrenNames("a/b"))
+	require.Len(index.tree["root"], 2)
+}
+
+type blockingPreviewGenerator struct {
+	mockPreviewGenerator
+	release chan struct{}
+}
+
+//nolint:ireturn
+func (mock blockingPreviewGenerator) Pull(ctx context.Context, item preview.Source) (preview.Data, error) {
+	<-mock.release
+
+	return mock.mockPreviewGenerator.Pull(ctx, item)
+}
+
+func TestIndexBuilderBackground(t *testing.T) {
+	t.Parallel()
+	require := require.New(t)
+
+	modTime := time.Date(2024, 11, 5, 5, 5, 5, 0, time.UTC)
+	files := []FileMeta{
+		&mockFile{relativePath: "a", name: "a", dir: true, modTime: modTime},
+		&mockFile{relativePath: "a/b.jpg", name: "b.jpg", modTime: modTime},
+		&mockFile{relativePath: "c.jpg", name: "c.jpg", modTime: modTime},
+	}
+
+	sampleData := make([]byte, 10)
+	generator := blockingPreviewGenerator{
+		mockPreviewGenerator: mockPreviewGenerator{sampleData: sampleData},
+		release:              make(chan struct{}),
+	}
+	index, err := NewIndex(
+		context.Background(),
+		nil,
+		WithFiles(files),
+		WithPreview(generator),
+		WithBackground(),
+	)
+	require.NoError(err)
+
+	// the files are listed while their previews are produced
+	require.Eventually(func() bool {
+		children, err := index.PullChildren(rootID)
+
+		return err == nil && len(children) == 2
+	}, time.Second, 10*time.Millisecond)
+
+	require.True(index.Progress().Active())
+
+	dir := index.Search("a", "")
+	require.Len(dir, 1)
+
+	children, err := index.PullChildren(dir[0].ID)
+	require.NoError(err)
+	require.Len(children, 1)
+
+	preview, err := index.PullPreview(children[0].ID)
+	require.NoError(err)
+	require.Empty(preview)
+
+	close(generator.release)
+	<-index.Done()
+	require.NoError(index.Err())
+	require.Equal(Progress{Done: 3, Total: 3, Workers: 1}, index.Progress())
+
+	preview, err = index.PullPreview(children[0].ID)
+	require.NoError(err)
+	require.Equal(sampleData, preview)
+}
+
+func TestIndexBuilderScan(t *testing.T) {
+	t.Parallel()
+	require := require.New(t)
+
+	modTime := time.Date(2024, 11, 5, 5, 5, 5, 0, time.UTC)
+	generator := WithPreview(mockPreviewGenerator{sampleData: make([]byte, 10)})
+	index, err := NewIndex(
+		context.Background(),
+		nil,
+		WithFiles([]FileMeta{&mockFile{relativePath: "a.jpg", name: "a.jpg", modTime: modTime}}),
+		generator,
+	)
+	require.NoError(err)
+
+	indexFile := bytes.Buffer{}
+	_, err = index.Encode(&indexFile)
+	require.NoError(err)
+
+	// the scan gets the decoded index and lists the files to load
+	decoded := []RelativePath{}
+	index, err = NewIndex(
+		context.Background(),
+		bytes.NewReader(indexFile.Bytes()),
+		WithScan(func(known *Index) ([]FileMeta, error) {
+			decoded = slices.Collect(maps.Keys(known.paths))
+
+			return []FileMeta{&mockFile{relativePath: "b.jpg", name: "b.jpg", modTime: modTime}}, nil
+		}),
+		generator,
+		WithRemovedFilesCleaning(),
+	)
+	require.NoError(err)
+	require.Equal([]RelativePath{"a.jpg"}, decoded)
+	require.NotContains(index.paths, RelativePath("a.jpg"))
+	require.Contains(index.paths, RelativePath("b.jpg"))
+
+	_, err = NewIndex(
+		context.Background(),
+		bytes.NewReader(indexFile.Bytes()),
+		WithScan(func(_ *Index) ([]FileMeta, error) { return nil, fs.ErrPermission }),
+	)
+	require.ErrorIs(err, ErrScan)
+	require.ErrorIs(err, fs.ErrPermission)
+}
+
+type probingPreviewGenerator struct {
+	mockPreviewGenerator
+	probe  preview.Probe
+	failed string
+	// reused requires the probed information to be passed to Pull
+	reused bool
+}
+
+//nolint:ireturn
+func (mock probingPreviewGenerator) Probe(_ context.Context, _ preview.Source) (preview.Probe, error) {
+	return mock.probe, nil
+}
+
+//nolint:ireturn
+func (mock probingPreviewGenerator) Pull(ctx context.Context, item preview.Source) (preview.Data, error) {
+	if strings.HasSuffix(item.Path(), mock.failed) {
+		return nil, fs.ErrInvalid
+	}
+
+	// the probed information is passed to the preview, so the file isn't probed again
+	if mock.reused {
+		probe, ok := item.(preview.ProbedSource).Probed() //nolint:forcetypeassert
+		if !ok || probe.Duration() != mock.probe.Duration() {
+			return nil, fs.ErrInvalid
+		}
+	}
+
+	return mock.mockPreviewGenerator.Pull(ctx, item)
+}
+
+type mockProbe struct {
+	mockPreviewData
+	duration time.Duration
+}
+
+func (m mockProbe) Duration() time.Duration {
+	return m.duration
+}
+
+func (m mockProbe) Resolution() (int, int) {
+	return 1920, 1080
+}
+
+func (m mockProbe) Codec() string {
+	return "h264"
+}
+
+func TestIndexBuilderProbe(t *testing.T) {
+	t.Parallel()
+	require := require.New(t)
+
+	modTime := time.Date(2024, 11, 5, 5, 5, 5, 0, time.UTC)
+	files := []FileMeta{
+		&mockFile{path: "/home/a.mp4", relativePath: "a.mp4", name: "a.mp4", modTime: modTime},
+		&mockFile{path: "/home/b.mp4", relativePath: "b.mp4", name: "b.mp4", modTime: modTime},
+	}
+
+	sampleData := make([]byte, 10)
+	index, err := NewIndex(
+		context.Background(),
+		nil,
+		WithFiles(files),
+		WithPreview(probingPreviewGenerator{
+			mockPreviewGenerator: mockPreviewGenerator{sampleData: sampleData},
+			probe:                mockProbe{duration: time.Minute},
+			failed:               "b.mp4",
+			reused:               true,
+		}),
+		WithWorkers(2),
+	)
+	require.NoError(err)
+	require.Len(index.meta, 2)
+
+	// the media information is kept, when the preview fails
+	for path, previewLength := range map[RelativePath]int{"a.mp4": len(sampleData), "b.mp4": 0} {
+		m := index.paths[path]
+		require.NotNil(m, path)
+		require.Equal(time.Minute, m.Duration, path)
+		require.Equal(Resolution{Width: 1920, Height: 1080}, m.Resolution, path)
+		require.Equal("h264", m.Codec, path)
+		require.Equal(uint64(previewLength), m.Preview.Length, path)
+	}
+}
+
+func TestIndexBuilderFailure(t *testing.T) {
+	t.Parallel()
+	require := require.New(t)
+
+	modTime := time.Date(2024, 11, 5, 5, 5, 5, 0, time.UTC)
+	files := []FileMeta{
+		&mockFile{path: "/home/a.mp4", relativePath: "a.mp4", name: "a.mp4", modTime: modTime},
+		&mockFile{path: "/home/b.mp4", relativePath: "b.mp4", name: "b.mp4", modTime: modTime},
+	}
+	generator := probingPreviewGenerator{
+		mockPreviewGenerator: mockPreviewGenerator{sampleData: make([]byte, 10)},
+		probe:                mockProbe{},
+		failed:               "b.mp4",
+	}
+	build := func(r io.Reader, opts ...Option) *Index {
+		opts = append(opts, WithFiles(files), WithPreview(generator))
+		index, err := NewIndex(context.Background(), r, opts...)
+		require.NoError(err)
+
+		return index
+	}
+	encode := func(index *Index) *bytes.Buffer {
+		buff := new(bytes.Buffer)
+		_, err := index.Encode(buff)
+		require.NoError(err)
+
+		return buff
+	}
+
+	index := build(nil)
+	failed := index.Failed()
+	require.Len(failed, 1)
+	require.Equal(RelativePath("b.mp4"), failed[0].RelativePath)
+	require.Equal(1, failed[0].Failure.Attempts)
+	require.Equal(fs.ErrInvalid.Error(), failed[0].Failure.Reason)
+
+	// the failed file isn't processed again until the backoff has passed
+	index = build(encode(index))
+	require.False(index.OutDated())
+	require.Equal(1, index.Failed()[0].Failure.Attempts)
+
+	index = build(encode(index), WithRetryFailed())
+	require.Equal(2, index.Failed()[0].Failure.Attempts)
+
+	failure := index.Failed()[0].Failure
+	require.Equal(failure.Time.Add(2*failureBackoff), failure.RetryAt())
+}
+
+type resolvedMockFile struct {
+	mockFile
+	realPath string
+}
+
+func (mock resolvedMockFile) RealPath() string {
+	return mock.realPath
+}
+
+type countingPreviewGenerator struct {
+	mockPreviewGenerator
+	pulls *atomic.Int32
+}
+
+//nolint:ireturn
+func (mock countingPreviewGenerator) Pull(ctx context.Context, item preview.Source) (preview.Data, error) {
+	mock.pulls.Add(1)
+
+	return mock.mockPreviewGenerator.Pull(ctx, item)
+}
+
+func TestIndexBuilderSharedFiles(t *testing.T) {
+	t.Parallel()
+	require := require.New(t)
+
+	modTime := time.Date(2024, 11, 5, 5, 5, 5, 0, time.UTC)
+	linked := func(name string, realPath string) FileMeta {
+		return &resolvedMockFile{
+			mockFile: mockFile{path: "/home/" + name, relativePath: name, name: name, modTime: modTime},
+			realPath: realPath,
+		}
+	}
+	generator := countingPreviewGenerator{
+		mockPreviewGenerator: mockPreviewGenerator{sampleData: make([]byte, 10)},
+		pulls:                new(atomic.Int32),
+	}
+
+	files := []FileMeta{linked("a.jpg", "/pool/x.jpg"), linked("b.jpg", "/pool/x.jpg"), linked("c.jpg", "/pool/c.jpg")}
+	index, err := NewIndex(context.Background(), nil, WithFiles(files), WithPreview(generator))
+	require.NoError(err)
+
+	// the file reached by two links is processed once, its preview is shared
+	require.Equal(int32(2), generator.pulls.Load())
+	require.Equal(index.paths["a.jpg"].Preview, index.paths["b.jpg"].Preview)
+	require.Equal("/pool/x.jpg", index.paths["b.jpg"].RealPath)
+	require.Equal(Progress{Done: 3, Total: 3, Workers: 1}, index.Progress())
+
+	buff := new(bytes.Buffer)
+	_, err = index.Encode(buff)
+	require.NoError(err)
+
+	// the new link to the processed file takes the saved preview
+	files = append(files, linked("d.jpg", "/pool/x.jpg"))
+	index, err = NewIndex(context.Background(), buff, WithFiles(files), WithPreview(generator))
+	require.NoError(err)
+	require.Equal(int32(2), generator.pulls.Load())
+	require.Equal(index.paths["a.jpg"].Preview, index.paths["d.jpg"].Preview)
+}
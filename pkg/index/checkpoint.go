@@ -0,0 +1,51 @@
+package index
+
+import (
+	"log/slog"
+	"time"
+)
+
+type checkpointParams struct {
+	interval time.Duration
+	previews int
+	save     func(index *Index) error
+}
+
+// checkpoint saves the index from time to time while files are loaded,
+// so an interrupted indexing resumes from the last saved state.
+type checkpoint struct {
+	params   checkpointParams
+	previews int
+	saved    time.Time
+}
+
+func newCheckpoint(params checkpointParams) *checkpoint {
+	return &checkpoint{
+		params: params,
+		saved:  time.Now(),
+	}
+}
+
+func (c *checkpoint) previewAdded(index *Index) {
+	if c.params.save == nil {
+		return
+	}
+
+	c.previews++
+
+	previewsPassed := c.params.previews > 0 && c.previews >= c.params.previews
+	intervalPassed := c.params.interval > 0 && time.Since(c.saved) >= c.params.interval
+
+	if !previewsPassed && !intervalPassed {
+		return
+	}
+
+	if err := c.params.save(index); err != nil {
+		slog.Error("Failed to save the index checkpoint", slog.String("error", err.Error()))
+	} else {
+		slog.Debug("Index checkpoint saved", slog.Int("new previews", c.previews))
+	}
+
+	c.previews = 0
+	c.saved = time.Now()
+}
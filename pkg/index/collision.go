@@ -0,0 +1,69 @@
+package index
+
+import (
+	"log/slog"
+	"strings"
+)
+
+// idClaims tracks IDs taken while files are loaded, so colliding IDs are resolved before
+// items get into the meta map. The files are handled in the scan order, which makes resolving deterministic.
+type idClaims struct {
+	index   *Index
+	claimed map[ID]RelativePath
+}
+
+func newIDClaims(index *Index) *idClaims {
+	return &idClaims{index: index, claimed: map[ID]RelativePath{}}
+}
+
+func (ic *idClaims) claim(m *Meta) {
+	ic.claimed[m.ID] = m.RelativePath
+}
+
+func (ic *idClaims) isClaimed(id ID) bool {
+	_, ok := ic.claimed[id]
+
+	return ok
+}
+
+// taken reports whether the ID belongs to other item.
+func (ic *idClaims) taken(m *Meta) bool {
+	if path, ok := ic.claimed[m.ID]; ok && path != m.RelativePath {
+		return true
+	}
+
+	existing, ok := ic.index.meta[m.ID]
+
+	return ok && existing.RelativePath != m.RelativePath
+}
+
+// resolve extends the ID of the item while it collides with other one.
+// The item, which has already got the extended ID, keeps it.
+func (ic *idClaims) resolve(m *Meta) {
+	if saved, ok := ic.index.paths[m.RelativePath]; ok && len(saved.ID) > len(m.ID) &&
+		strings.HasPrefix(m.idDigest, string(saved.ID)) {
+		m.ID = saved.ID
+
+		return
+	}
+
+	if !ic.taken(m) {
+		return
+	}
+
+	for ic.taken(m) {
+		if !m.extendID() {
+			slog.Error("The ID collision can't be resolved", slog.String("path", string(m.RelativePath)))
+
+			return
+		}
+	}
+
+	// the file is counted once, however many extensions it took
+	slog.Debug(
+		"The ID collision is resolved",
+		slog.String("path", string(m.RelativePath)),
+		slog.String("id", string(m.ID)),
+	)
+	ic.index.collisions++
+}
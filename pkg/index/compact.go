@@ -0,0 +1,256 @@
+package index
+
+import (
+	"bytes"
+	"cmp"
+	"fmt"
+	"io"
+	"maps"
+	"slices"
+)
+
+// livePreviews returns items, which previews start at the offset or later, ordered by preview offset.
+func (index *Index) livePreviews(from uint64) []*Meta {
+	items := make([]*Meta, 0)
+
+	for _, m := range index.meta {
+		if m.Preview.Length != 0 && m.Preview.Offset >= from {
+			items = append(items, m)
+		}
+	}
+
+	slices.SortFunc(items, func(a, b *Meta) int {
+		return cmp.Compare(a.Preview.Offset, b.Preview.Offset)
+	})
+
+	return items
+}
+
+// previewsSize returns size of the items previews, the shared ones are counted once.
+func previewsSize(items []*Meta) uint64 {
+	size := uint64(0)
+	seen := make(map[uint64]struct{}, len(items))
+
+	for _, m := range items {
+		if _, ok := seen[m.Preview.Offset]; !ok {
+			seen[m.Preview.Offset] = struct{}{}
+			size += m.Preview.Length
+		}
+	}
+
+	return size
+}
+
+// Garbage returns size of the previews part, which is taken by previews of removed items.
+func (index *Index) Garbage() uint64 {
+	index.mu.RLock()
+	defer index.mu.RUnlock()
+
+	return index.garbage()
+}
+
+func (index *Index) garbage() uint64 {
+	return index.blobSize() - previewsSize(index.livePreviews(0))
+}
+
+// Compact writes the index file at path anew, so its previews part contains only previews of the index items,
+// they are copied one by one from the previous file. Returns the count of freed bytes and the size of the file.
+// The index is locked only to take the snapshot of it and to switch it to the new file.
+func (index *Index) Compact(path string) (uint64, uint64, error) {
+	index.saving.Lock()
+	defer index.saving.Unlock()
+
+	state, err := index.compactSnapshot()
+	if err != nil || state.garbage == 0 {
+		return 0, 0, err
+	}
+
+	count, err := index.writeCompacted(path, state)
+	if err != nil {
+		return 0, 0, err
+	}
+
+	return state.garbage, count, nil
+}
+
+// writeCompacted writes the snapshot into the file at path without the index locked,
+// then switches the index to the file.
+func (index *Index) writeCompacted(path string, state compacted) (uint64, error) {
+	saved, count, err := writeFile(path, newHeader(state.meta, state.count, state.blobSize), state.meta, state.blob)
+	if err != nil {
+		index.setOutDated(true)
+
+		return 0, err
+	}
+
+	index.mu.Lock()
+	defer index.mu.Unlock()
+
+	// the previews added while the file was written stay in memory
+	written := state.end - index.source.size
+
+	index.switchCompacted(state)
+	index.readFrom(saved)
+	index.data = bytes.Clone(index.data[written:])
+
+	return count, nil
+}
+
+// compacted is the index state taken to be written by Compact.
+type compacted struct {
+	meta    []byte
+	count   uint32
+	garbage uint64
+	// blob reads the live previews one after another, blobSize is their size
+	blob     io.Reader
+	blobSize uint64
+	// end is the previews part size at the moment, previews added later stay in memory
+	end uint64
+	// offsets maps offsets of the live previews to their offsets in the new file
+	offsets map[uint64]uint64
+}
+
+func (index *Index) compactSnapshot() (compacted, error) {
+	index.mu.Lock()
+	defer index.mu.Unlock()
+
+	garbage := index.garbage()
+	if garbage == 0 {
+		return compacted{}, nil
+	}
+
+	items := index.livePreviews(0)
+	moved, previews := index.relocate(items, 0)
+	meta := maps.Clone(index.meta)
+	offsets := make(map[uint64]uint64, len(items))
+
+	for i, m := range moved {
+		meta[m.ID] = m
+		offsets[items[i].Preview.Offset] = m.Preview.Offset
+	}
+
+	encoded, err := encodeMeta(meta)
+	if err != nil {
+		return compacted{}, err
+	}
+
+	// changes made while the file is written make the index outdated again
+	index.outDated = false
+
+	return compacted{
+		meta:     encoded,
+		count:    uint32(len(meta)),
+		garbage:  garbage,
+		blob:     io.MultiReader(previews...),
+		blobSize: previewsSize(items),
+		end:      index.blobSize(),
+		offsets:  offsets,
+	}, nil
+}
+
+// switchCompacted moves previews of the items to their offsets in the compacted file,
+// the ones added while it was written are put after its previews part.
+func (index *Index) switchCompacted(state compacted) {
+	moved := make([]*Meta, 0)
+
+	for _, m := range index.meta {
+		if m.Preview.Length == 0 {
+			continue
+		}
+
+		offset, ok := state.offsets[m.Preview.Offset]
+		if m.Preview.Offset >= state.end {
+			offset, ok = m.Preview.Offset-state.end+state.blobSize, true
+		}
+
+		if ok && offset == m.Preview.Offset {
+			continue
+		}
+
+		// items are never changed after they are put
+		copied := *m
+		copied.Preview.Offset = offset
+
+		// the preview isn't in the compacted file, it's produced again
+		if !ok {
+			copied.Preview = PreviewLocation{}
+			index.outDated = true
+		}
+
+		moved = append(moved, &copied)
+	}
+
+	for _, m := range moved {
+		index.put(m)
+	}
+}
+
+// compactData puts the in-memory previews one after another, the part read lazily stays on disk untouched.
+func (index *Index) compactData() error {
+	// the save in progress writes the in-memory previews as they are, they are compacted next time
+	if !index.saving.TryLock() {
+		return nil
+	}
+	defer index.saving.Unlock()
+
+	from := index.source.size
+	items := index.livePreviews(from)
+
+	if uint64(len(index.data)) == previewsSize(items) {
+		return nil
+	}
+
+	moved, previews := index.relocate(items, from)
+	data := bytes.NewBuffer(make([]byte, 0, previewsSize(items)))
+
+	if _, err := data.ReadFrom(io.MultiReader(previews...)); err != nil {
+		return fmt.Errorf("%w: %w", ErrReadPreview, err)
+	}
+
+	for _, m := range moved {
+		index.put(m)
+	}
+
+	index.data = data.Bytes()
+	index.outDated = true
+
+	return nil
+}
+
+// relocate returns copies of the items, which previews are put one after another starting at the offset,
+// and readers of the previews in the new order, the shared ones are read once.
+func (index *Index) relocate(items []*Meta, from uint64) ([]*Meta, []io.Reader) {
+	moved := make([]*Meta, 0, len(items))
+	previews := make([]io.Reader, 0, len(items))
+	offsets := make(map[uint64]uint64, len(items))
+	next := from
+
+	for _, m := range items {
+		offset, ok := offsets[m.Preview.Offset]
+		if !ok {
+			offset = next
+			offsets[m.Preview.Offset] = offset
+			next += m.Preview.Length
+
+			previews = append(previews, index.previewReader(m.Preview))
+		}
+
+		// items are never changed after they are put
+		copied := *m
+		copied.Preview.Offset = offset
+		moved = append(moved, &copied)
+	}
+
+	return moved, previews
+}
+
+// previewReader returns the reader of the preview, which reads it on demand.
+func (index *Index) previewReader(location PreviewLocation) io.Reader {
+	if location.Offset >= index.source.size {
+		offset := location.Offset - index.source.size
+
+		return bytes.NewReader(index.data[offset : offset+location.Length])
+	}
+
+	return io.NewSectionReader(index.source.reader, index.source.offset+int64(location.Offset), int64(location.Length))
+}
@@ -0,0 +1,138 @@
+package index
+
+import (
+	"bytes"
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestIndexCompact(t *testing.T) {
+	t.Parallel()
+	require := require.New(t)
+
+	indexOriginal, err := NewIndex(context.Background(), nil)
+	require.NoError(err)
+
+	files := []FileMeta{}
+
+	for i, name := range []string{"a.jpg", "b.jpg", "c.jpg"} {
+		file := &mockFile{relativePath: name, name: name, modTime: time.Date(2024, 11, 5, 5, 5, 5, 0, time.UTC)}
+		files = append(files, file)
+
+		m := metaByFile(file)
+		m.Preview = indexOriginal.appendPreview(bytes.Repeat([]byte{byte(i + 1)}, 10*(i+1)))
+		indexOriginal.meta[m.ID] = m
+	}
+
+	buff := new(bytes.Buffer)
+	_, err = indexOriginal.Encode(buff)
+	require.NoError(err)
+
+	// b.jpg is removed, its preview stays in the lazily read part
+	index, err := NewIndex(
+		context.Background(),
+		bytes.NewReader(buff.Bytes()),
+		WithLazyPreviews(),
+		WithRemovedFilesCleaning(),
+		WithFiles([]FileMeta{files[0], files[2]}),
+	)
+	require.NoError(err)
+	require.Len(index.meta, 2)
+	require.EqualValues(20, index.Garbage())
+
+	kept := index.meta[metaByFile(files[2]).ID]
+	path := filepath.Join(t.TempDir(), "index.tinytune")
+
+	freed, count, err := index.Compact(path)
+	require.NoError(err)
+	require.EqualValues(20, freed)
+	require.Zero(index.Garbage())
+	require.EqualValues(40, index.blobSize())
+	require.Empty(index.data)
+	require.False(index.OutDated())
+	// items are copied, not changed
+	require.EqualValues(30, kept.Preview.Offset)
+
+	info, err := os.Stat(path)
+	require.NoError(err)
+	require.EqualValues(count, info.Size())
+
+	file, err := Open(path)
+	require.NoError(err)
+
+	compacted, err := NewIndex(context.Background(), file, WithLazyPreviews())
+	require.NoError(err)
+
+	for _, file := range []FileMeta{files[0], files[2]} {
+		original := indexOriginal.meta[metaByFile(file).ID]
+		expected := indexOriginal.data[original.Preview.Offset:][:original.Preview.Length]
+
+		preview, err := index.PullPreview(original.ID)
+		require.NoError(err)
+		require.Equal(expected, preview)
+
+		preview, err = compacted.PullPreview(original.ID)
+		require.NoError(err)
+		require.Equal(expected, preview)
+	}
+
+	require.NoError(file.Close())
+	require.NoError(index.Close())
+
+	freed, _, err = index.Compact(path)
+	require.NoError(err)
+	require.Zero(freed)
+}
+
+func TestIndexCompactConcurrentChanges(t *testing.T) {
+	t.Parallel()
+	require := require.New(t)
+
+	index, err := NewIndex(context.Background(), nil)
+	require.NoError(err)
+
+	items := []*Meta{}
+
+	for i, name := range []string{"a.jpg", "b.jpg"} {
+		file := &mockFile{relativePath: name, name: name, modTime: time.Date(2024, 11, 5, 5, 5, 5, 0, time.UTC)}
+
+		m := metaByFile(file)
+		m.Preview = index.appendPreview(bytes.Repeat([]byte{byte(i + 1)}, 10))
+		index.put(m)
+		items = append(items, m)
+	}
+
+	index.drop(items[0])
+
+	state, err := index.compactSnapshot()
+	require.NoError(err)
+	require.EqualValues(10, state.garbage)
+
+	// the item added while the file is written
+	file := &mockFile{relativePath: "c.jpg", name: "c.jpg", modTime: time.Date(2024, 11, 5, 5, 5, 5, 0, time.UTC)}
+	added := metaByFile(file)
+	added.Preview = index.appendPreview(bytes.Repeat([]byte{3}, 10))
+	index.put(added)
+	index.outDated = true
+
+	_, err = index.writeCompacted(filepath.Join(t.TempDir(), "index.tinytune"), state)
+	require.NoError(err)
+	require.EqualValues(20, index.blobSize())
+	require.Len(index.data, 10)
+	require.True(index.OutDated())
+	require.EqualValues(0, index.meta[items[1].ID].Preview.Offset)
+	require.EqualValues(10, index.meta[added.ID].Preview.Offset)
+
+	for i, m := range []*Meta{items[1], added} {
+		preview, err := index.PullPreview(m.ID)
+		require.NoError(err)
+		require.Equal(bytes.Repeat([]byte{byte(i + 2)}, 10), preview)
+	}
+
+	require.NoError(index.Close())
+}
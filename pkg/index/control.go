@@ -0,0 +1,49 @@
+package index
+
+import "context"
+
+// Pause stops loading new files, the files already being loaded are finished.
+func (index *Index) Pause() {
+	index.pool.setPaused(true)
+}
+
+func (index *Index) Resume() {
+	index.pool.setPaused(false)
+}
+
+// SetWorkers changes the count of files loaded at the same time.
+func (index *Index) SetWorkers(workers int) {
+	index.pool.setLimit(workers)
+}
+
+// Cancel stops loading the files, the loaded ones are kept and the rest are loaded at the next start.
+func (index *Index) Cancel() {
+	index.mu.RLock()
+	defer index.mu.RUnlock()
+
+	if index.cancel != nil {
+		index.cancel()
+	}
+}
+
+// cancelable makes the loading stopped by Cancel, the returned function has to be called after it.
+func (index *Index) cancelable(ctx context.Context) (context.Context, func()) {
+	ctx, cancel := context.WithCancel(ctx)
+
+	index.mu.Lock()
+	index.cancel = cancel
+	index.mu.Unlock()
+
+	return ctx, func() {
+		index.mu.Lock()
+		defer index.mu.Unlock()
+
+		// files left after the cancellation aren't waited for
+		if ctx.Err() != nil {
+			index.progress.Total = index.progress.Done
+		}
+
+		index.cancel = nil
+		cancel()
+	}
+}
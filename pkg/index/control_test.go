@@ -0,0 +1,55 @@
+package index
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestIndexControl(t *testing.T) {
+	t.Parallel()
+	require := require.New(t)
+
+	modTime := time.Date(2024, 11, 5, 5, 5, 5, 0, time.UTC)
+	files := []FileMeta{
+		&mockFile{relativePath: "a.jpg", name: "a.jpg", modTime: modTime},
+		&mockFile{relativePath: "b.jpg", name: "b.jpg", modTime: modTime},
+		&mockFile{relativePath: "c.jpg", name: "c.jpg", modTime: modTime},
+	}
+	build := func() (*Index, blockingPreviewGenerator) {
+		generator := blockingPreviewGenerator{
+			mockPreviewGenerator: mockPreviewGenerator{sampleData: make([]byte, 10)},
+			release:              make(chan struct{}),
+		}
+		index, err := NewIndex(context.Background(), nil, WithFiles(files), WithPreview(generator), WithBackground())
+		require.NoError(err)
+
+		return index, generator
+	}
+
+	// the paused loading finishes only the files already being loaded
+	index, generator := build()
+	index.Pause()
+	close(generator.release)
+	time.Sleep(50 * time.Millisecond)
+
+	progress := index.Progress()
+	require.True(progress.Paused)
+	require.LessOrEqual(progress.Done, 1)
+
+	index.SetWorkers(2)
+	index.Resume()
+	<-index.Done()
+	require.Equal(Progress{Done: 3, Total: 3, Workers: 2}, index.Progress())
+
+	// the canceled loading keeps the files listed without previews
+	index, _ = build()
+	index.Pause()
+	index.Cancel()
+	<-index.Done()
+	require.NoError(index.Err())
+	require.False(index.Progress().Active())
+	require.Len(index.meta, 3)
+}
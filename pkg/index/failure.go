@@ -0,0 +1,62 @@
+package index
+
+import (
+	"cmp"
+	"slices"
+	"time"
+)
+
+// the failed file is processed again after the backoff, which doubles with each attempt up to the maximum.
+const (
+	failureBackoff    = time.Hour
+	maxFailureBackoff = 30 * 24 * time.Hour
+	maxBackoffShift   = 10
+)
+
+// Failure is the failed attempt to produce the preview of the file.
+type Failure struct {
+	Reason   string    `json:"reason"`
+	Attempts int       `json:"attempts"`
+	Time     time.Time `json:"time"`
+}
+
+func newFailure(previous *Failure, err error) *Failure {
+	attempts := 1
+	if previous != nil {
+		attempts = previous.Attempts + 1
+	}
+
+	return &Failure{Reason: err.Error(), Attempts: attempts, Time: time.Now()}
+}
+
+// RetryAt returns the time, when the file is processed again.
+func (f *Failure) RetryAt() time.Time {
+	shift := min(max(f.Attempts-1, 0), maxBackoffShift)
+
+	return f.Time.Add(min(failureBackoff<<shift, maxFailureBackoff))
+}
+
+// postponed reports whether the item has failed and it's too early to retry it.
+func (ib *indexBuilder) postponed(m *Meta) bool {
+	return m.Failure != nil && !ib.params.retryFailed && time.Now().Before(m.Failure.RetryAt())
+}
+
+// Failed returns items of the files, which previews failed to be produced, sorted by path.
+func (index *Index) Failed() []*Meta {
+	index.mu.RLock()
+	defer index.mu.RUnlock()
+
+	result := []*Meta{}
+
+	for _, m := range index.meta {
+		if m.Failure != nil {
+			result = append(result, m)
+		}
+	}
+
+	slices.SortFunc(result, func(a, b *Meta) int {
+		return cmp.Compare(a.RelativePath, b.RelativePath)
+	})
+
+	return result
+}
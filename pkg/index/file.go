@@ -0,0 +1,367 @@
+package index
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"log/slog"
+	"os"
+	"path/filepath"
+)
+
+var (
+	ErrFileTruncated = errors.New("index file is truncated")
+	ErrFileCreate    = errors.New("failed to create index file")
+	ErrFileSync      = errors.New("failed to sync index file")
+	ErrFileClose     = errors.New("failed to close index file")
+	ErrFileTruncate  = errors.New("failed to truncate index file")
+	ErrFileRotate    = errors.New("failed to rotate index file")
+	ErrFileOpen      = errors.New("failed to open index file")
+	ErrFileStat      = errors.New("failed to stat index file")
+)
+
+const (
+	fileRights   = 0o644
+	dirRights    = 0o755
+	tempSuffix   = ".tmp"
+	backupSuffix = ".bak"
+)
+
+// FilePaths returns the index file path with paths of its temporary and backup files.
+func FilePaths(path string) []string {
+	return []string{path, path + tempSuffix, path + backupSuffix}
+}
+
+// Save writes the index into the file at path. Previews added since the file was read or saved
+// are appended to it, they are read from it afterwards. The file is written anew, if it's of an older version,
+// isn't the one the index is read from or its meta part has outgrown the reserved space: the new file is synced
+// and atomically replaces the file at path, the previous version of it is kept as the backup.
+func (index *Index) Save(path string) (uint64, error) {
+	index.saving.Lock()
+	defer index.saving.Unlock()
+
+	// changes made while the index is saved make it outdated again
+	index.setOutDated(false)
+
+	count, err := index.save(path)
+	if err != nil {
+		index.setOutDated(true)
+	}
+
+	return count, err
+}
+
+func (index *Index) setOutDated(outDated bool) {
+	index.mu.Lock()
+	defer index.mu.Unlock()
+
+	index.outDated = outDated
+}
+
+func (index *Index) save(path string) (uint64, error) {
+	state, err := index.snapshot()
+	if err != nil {
+		return 0, err
+	}
+
+	saved, count := blobSource{}, uint64(0)
+
+	if state.appendable(path) {
+		saved, count, err = state.append(path)
+	} else {
+		saved, count, err = state.rewrite(path)
+	}
+
+	if err != nil {
+		return 0, err
+	}
+
+	index.mu.Lock()
+	defer index.mu.Unlock()
+
+	// the saved previews are read from the file, the ones added while it was written stay in memory
+	index.readFrom(saved)
+	index.data = bytes.Clone(index.data[len(state.data):])
+
+	return count, nil
+}
+
+// readFrom makes the index read previews from the saved file, the file opened by the previous save is closed.
+func (index *Index) readFrom(saved blobSource) {
+	if saved.reader != index.source.reader {
+		// previews aren't read from it anymore, so the error doesn't matter
+		_ = index.closeFile()
+		index.file, _ = saved.reader.(*os.File)
+	}
+
+	index.source = saved
+}
+
+// appendable reports whether the snapshot can be appended to the file at path:
+// it's the file of the current version, which the index is read from, and its free meta slot fits the meta part.
+func (s snapshot) appendable(path string) bool {
+	if s.source.header.version != currentVersion || len(s.meta) > int(s.source.header.slotSize) {
+		return false
+	}
+
+	source, ok := s.source.reader.(interface{ Stat() (fs.FileInfo, error) })
+	if !ok {
+		return false
+	}
+
+	sourceInfo, err := source.Stat()
+	if err != nil {
+		return false
+	}
+
+	info, err := os.Stat(path)
+
+	return err == nil && os.SameFile(sourceInfo, info)
+}
+
+// append writes the new previews after the previews part of the file and the meta part into its free slot,
+// then switches the header to them. The file keeps the previous version until the header is written.
+func (s snapshot) append(path string) (blobSource, uint64, error) {
+	file, err := os.OpenFile(path, os.O_WRONLY, 0)
+	if err != nil {
+		return blobSource{}, 0, fmt.Errorf("%w: %w", ErrFileOpen, err)
+	}
+
+	header := s.header()
+	header.slotSize = s.source.header.slotSize
+	header.metaSlot = 1 - s.source.header.metaSlot
+
+	if err := s.writeAt(file, header); err != nil {
+		file.Close()
+
+		return blobSource{}, 0, err
+	}
+
+	if err := file.Close(); err != nil {
+		return blobSource{}, 0, fmt.Errorf("%w: %w", ErrFileClose, err)
+	}
+
+	saved := blobSource{
+		reader: s.source.reader,
+		offset: s.source.offset,
+		size:   header.blobSize,
+		header: header,
+	}
+
+	return saved, uint64(header.blobOffset()) + header.blobSize, nil
+}
+
+func (s snapshot) writeAt(file *os.File, header header) error {
+	if _, err := file.WriteAt(s.data, s.source.offset+int64(s.source.size)); err != nil {
+		return fmt.Errorf("%w: %w", ErrWriteBinaryData, err)
+	}
+
+	if _, err := file.WriteAt(s.meta, header.metaOffset()); err != nil {
+		return fmt.Errorf("%w: %w", ErrWriteMetaPart, err)
+	}
+
+	if err := file.Sync(); err != nil {
+		return fmt.Errorf("%w: %w", ErrFileSync, err)
+	}
+
+	headerBuffer := bytes.NewBuffer(make([]byte, 0, header.size()))
+	if err := header.write(headerBuffer); err != nil {
+		return err
+	}
+
+	if _, err := file.WriteAt(headerBuffer.Bytes(), 0); err != nil {
+		return fmt.Errorf("%w: %w", ErrWriteHeader, err)
+	}
+
+	// drops bytes left by an interrupted save
+	if err := file.Truncate(header.blobOffset() + int64(header.blobSize)); err != nil {
+		return fmt.Errorf("%w: %w", ErrFileTruncate, err)
+	}
+
+	if err := file.Sync(); err != nil {
+		return fmt.Errorf("%w: %w", ErrFileSync, err)
+	}
+
+	return nil
+}
+
+func (s snapshot) rewrite(path string) (blobSource, uint64, error) {
+	return writeFile(path, s.header(), s.meta, s.blob())
+}
+
+// writeFile writes the new file into the temporary one, syncs it and atomically replaces the file at path,
+// the replaced one is kept as the backup. The returned source reads previews from the new file.
+func writeFile(path string, header header, meta []byte, blob io.Reader) (blobSource, uint64, error) {
+	tempPath := path + tempSuffix
+
+	if err := os.MkdirAll(filepath.Dir(path), fs.FileMode(dirRights)); err != nil {
+		return blobSource{}, 0, fmt.Errorf("%w: %w", ErrFileCreate, err)
+	}
+
+	file, err := os.OpenFile(tempPath, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, fs.FileMode(fileRights))
+	if err != nil {
+		return blobSource{}, 0, fmt.Errorf("%w: %w", ErrFileCreate, err)
+	}
+
+	count, err := encodeFile(file, header, meta, blob)
+	if err != nil {
+		file.Close()
+
+		return blobSource{}, 0, err
+	}
+
+	if err := file.Sync(); err != nil {
+		file.Close()
+
+		return blobSource{}, 0, fmt.Errorf("%w: %w", ErrFileSync, err)
+	}
+
+	if err := file.Close(); err != nil {
+		return blobSource{}, 0, fmt.Errorf("%w: %w", ErrFileClose, err)
+	}
+
+	// previews are still read from the replaced file until the new one is opened,
+	// it's fine as the opened file descriptor keeps the data available
+	if err := os.Rename(path, path+backupSuffix); err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return blobSource{}, 0, fmt.Errorf("%w: %w", ErrFileRotate, err)
+	}
+
+	if err := os.Rename(tempPath, path); err != nil {
+		return blobSource{}, 0, fmt.Errorf("%w: %w", ErrFileRotate, err)
+	}
+
+	if err := syncDir(filepath.Dir(path)); err != nil {
+		return blobSource{}, 0, err
+	}
+
+	saved, err := os.Open(path)
+	if err != nil {
+		return blobSource{}, 0, fmt.Errorf("%w: %w", ErrFileOpen, err)
+	}
+
+	return blobSource{reader: saved, offset: header.blobOffset(), size: header.blobSize, header: header}, count, nil
+}
+
+// Close closes the index file opened by saves, previews read lazily aren't available afterwards.
+func (index *Index) Close() error {
+	index.mu.Lock()
+	defer index.mu.Unlock()
+
+	return index.closeFile()
+}
+
+func (index *Index) closeFile() error {
+	if index.file == nil {
+		return nil
+	}
+
+	err := index.file.Close()
+	index.file = nil
+
+	if err != nil {
+		return fmt.Errorf("%w: %w", ErrFileClose, err)
+	}
+
+	return nil
+}
+
+func syncDir(path string) error {
+	dir, err := os.Open(path)
+	if err != nil {
+		return fmt.Errorf("%w: %w", ErrFileSync, err)
+	}
+	defer dir.Close()
+
+	if err := dir.Sync(); err != nil {
+		return fmt.Errorf("%w: %w", ErrFileSync, err)
+	}
+
+	return nil
+}
+
+// Open opens the index file at path. If it's missed, truncated or corrupted, the backup is opened instead.
+// The backup is kept only by full rewrites, so it may be many saves old: previews appended since then are lost
+// and produced again. Returns nil file, if there is no usable one.
+func Open(path string) (*os.File, error) {
+	file, err := openFile(path)
+	if err == nil || errors.Is(err, ErrUnsupportedVersion) {
+		return file, err
+	}
+
+	if !errors.Is(err, fs.ErrNotExist) {
+		slog.Warn("The index file is damaged, trying the backup", slog.String("error", err.Error()))
+	}
+
+	backupPath := path + backupSuffix
+
+	backup, backupErr := openFile(backupPath)
+	if backupErr == nil {
+		slog.Warn("The index file backup is used", slog.String("path", backupPath))
+
+		return backup, nil
+	}
+
+	if errors.Is(backupErr, ErrUnsupportedVersion) {
+		return nil, backupErr
+	}
+
+	if !errors.Is(err, fs.ErrNotExist) {
+		slog.Warn("The index file has no usable backup, it will be created again")
+	}
+
+	return nil, nil //nolint:nilnil
+}
+
+func openFile(path string) (*os.File, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrFileOpen, err)
+	}
+
+	if err := CheckFile(file); err != nil {
+		file.Close()
+
+		return nil, err
+	}
+
+	return file, nil
+}
+
+// CheckFile verifies the index file isn't truncated and its meta part is intact.
+// Previews are verified by Index.Verify.
+func CheckFile(file *os.File) error {
+	info, err := file.Stat()
+	if err != nil {
+		return fmt.Errorf("%w: %w", ErrFileStat, err)
+	}
+
+	if info.Size() == 0 {
+		return fmt.Errorf("%w: empty file", ErrFileTruncated)
+	}
+
+	header, err := readHeader(file)
+	if err != nil {
+		return err
+	}
+
+	expected := header.blobOffset() + int64(header.blobSize)
+
+	// the previews part size of legacy files is unknown, so they can be checked only partly,
+	// bytes after the previews part are left by an interrupted save
+	if info.Size() < expected {
+		return fmt.Errorf("%w: expected %d bytes, got %d", ErrFileTruncated, expected, info.Size())
+	}
+
+	metaPart := io.NewSectionReader(file, header.metaOffset(), int64(header.metaPartSize))
+	if _, err := readMetaPart(metaPart, header); err != nil {
+		return err
+	}
+
+	if _, err := file.Seek(0, 0); err != nil {
+		return fmt.Errorf("%w: %w", ErrSourceSeeking, err)
+	}
+
+	return nil
+}
@@ -0,0 +1,119 @@
+package index
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestIndexSaveOpen(t *testing.T) {
+	t.Parallel()
+	require := require.New(t)
+
+	path := filepath.Join(t.TempDir(), "index.tinytune")
+
+	file, err := Open(path)
+	require.NoError(err)
+	require.Nil(file)
+
+	index, err := NewIndex(context.Background(), nil)
+	require.NoError(err)
+
+	index.meta = map[ID]*Meta{
+		"2cf24dba5fb": {
+			Name:         "abc.jpg",
+			ID:           "2cf24dba5fb",
+			RelativePath: "test/abc.jpg",
+			ModTime:      time.Date(2024, 11, 5, 5, 5, 5, 0, time.UTC),
+			Type:         ContentTypeImage,
+			Preview:      PreviewLocation{Length: 10},
+		},
+	}
+	index.data = make([]byte, 10)
+
+	// first generation
+	_, err = index.Save(path)
+	require.NoError(err)
+	require.NoFileExists(path + backupSuffix)
+	require.Empty(index.data)
+
+	// new previews are appended to the file and read from it
+	preview := []byte("appended")
+	index.meta["5762029e772"] = &Meta{
+		ID:           "5762029e772",
+		Name:         "def.jpg",
+		RelativePath: "test/def.jpg",
+		Type:         ContentTypeImage,
+		Preview:      index.appendPreview(preview),
+	}
+	count, err := index.Save(path)
+	require.NoError(err)
+	require.NoFileExists(path + backupSuffix)
+	require.Empty(index.data)
+
+	info, err := os.Stat(path)
+	require.NoError(err)
+	require.EqualValues(count, info.Size())
+
+	appended, err := index.PullPreview("5762029e772")
+	require.NoError(err)
+	require.Equal(preview, appended)
+
+	// bytes left by an interrupted save are ignored
+	file, err = os.OpenFile(path, os.O_WRONLY|os.O_APPEND, 0)
+	require.NoError(err)
+	_, err = file.WriteString("interrupted")
+	require.NoError(err)
+	require.NoError(file.Close())
+
+	file, err = Open(path)
+	require.NoError(err)
+
+	reopened, err := NewIndex(context.Background(), file, WithLazyPreviews())
+	require.NoError(err)
+	require.Len(reopened.meta, 2)
+	require.NoError(file.Close())
+
+	// the file is written anew, when the index is read from another one
+	_, err = index.Save(filepath.Join(t.TempDir(), "index.tinytune"))
+	require.NoError(err)
+
+	index.meta["2ca6e2b7c2f"] = &Meta{ID: "2ca6e2b7c2f", Name: "test", RelativePath: "test", IsDir: true}
+	count, err = index.Save(path)
+	require.NoError(err)
+	require.FileExists(path + backupSuffix)
+	require.NoFileExists(path + tempSuffix)
+	require.NoError(index.Close())
+
+	file, err = Open(path)
+	require.NoError(err)
+	require.Equal(path, file.Name())
+	require.NoError(file.Close())
+
+	// truncated primary falls back to the backup
+	require.NoError(os.Truncate(path, int64(count)-1))
+
+	file, err = Open(path)
+	require.NoError(err)
+	require.Equal(path+backupSuffix, file.Name())
+
+	restored, err := NewIndex(context.Background(), file, WithLazyPreviews())
+	require.NoError(err)
+	require.Len(restored.meta, 2)
+
+	restoredPreview, err := restored.PullPreview("5762029e772")
+	require.NoError(err)
+	require.Equal(preview, restoredPreview)
+	require.NoError(file.Close())
+
+	// there is nothing to fall back to
+	require.NoError(os.Truncate(path+backupSuffix, 0))
+
+	file, err = Open(path)
+	require.NoError(err)
+	require.Nil(file)
+}
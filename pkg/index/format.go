@@ -7,6 +7,7 @@ import (
 	"encoding/json"
 	"errors"
 	"fmt"
+	"hash/crc32"
 	"io"
 
 	"github.com/alxarno/tinytune/pkg/bytesutil"
@@ -15,16 +16,27 @@ import (
 var (
 	ErrInvalidHeader       = errors.New("invalid header")
 	ErrReadHeader          = errors.New("failed to read header")
+	ErrReadVersion         = errors.New("failed to read version")
 	ErrReadMetaItemsCount  = errors.New("failed to read meta items count")
 	ErrReadMetaPartSize    = errors.New("failed to read meta's part size")
 	ErrReadMetaPart        = errors.New("failed to read meta items")
+	ErrReadBlobSize        = errors.New("failed to read binary data size")
+	ErrReadMetaChecksum    = errors.New("failed to read meta's part checksum")
+	ErrReadMetaSlot        = errors.New("failed to read meta's part slot")
+	ErrReadHeaderChecksum  = errors.New("failed to read header checksum")
+	ErrChecksumMismatch    = errors.New("checksum mismatch")
 	ErrMetaItemDecode      = errors.New("failed to decode meta's item")
 	ErrReadBinaryData      = errors.New("failed to read binary data")
 	ErrWriteHeader         = errors.New("failed to write header")
+	ErrWriteVersion        = errors.New("failed to write version")
 	ErrWriteMetaItemsCount = errors.New("failed to write meta items count")
 	ErrEncodeMetaItem      = errors.New("failed to encode meta's item")
 	ErrWriteMetaPartSize   = errors.New("failed to write meta's part size")
 	ErrWriteMetaPart       = errors.New("failed to write meta items")
+	ErrWriteBlobSize       = errors.New("failed to write binary data size")
+	ErrWriteMetaChecksum   = errors.New("failed to write meta's part checksum")
+	ErrWriteMetaSlot       = errors.New("failed to write meta's part slot")
+	ErrWriteHeaderChecksum = errors.New("failed to write header checksum")
 	ErrWriteBinaryData     = errors.New("failed to write binary data")
 
 	ErrJSONEncode       = errors.New("failed to JSON encode item")
@@ -40,102 +52,417 @@ var (
 const indexHeader = "TINYTUNE_INDEX"
 const metaItemsCountSize = 4
 
+// minMetaSlotSize is the least size of meta slots of a new file, slots take twice the meta part,
+// so it can grow before the file has to be rewritten.
+const minMetaSlotSize = 64 << 10
+
 func (index *Index) Decode(r io.Reader) error {
 	if r == nil {
 		return nil
 	}
-	// read header
-	header := make([]byte, len([]byte(indexHeader)))
 
-	n, err := r.Read(header)
+	header, err := index.decodeMeta(r)
 	if err != nil {
-		return fmt.Errorf("%w: %w", ErrReadHeader, err)
+		return err
 	}
 
-	if n == 0 {
+	data, err := readBlob(r, header)
+	if err != nil {
+		return err
+	}
+
+	index.data = data
+
+	return index.migrate(header.version)
+}
+
+// DecodeLazy reads only header and meta part, previews are read from r on demand,
+// so r must stay open while the index is used.
+func (index *Index) DecodeLazy(r io.ReaderAt, size int64) error {
+	if size == 0 {
 		return nil
 	}
 
-	if string(header) != indexHeader {
-		return fmt.Errorf("%s is %w", string(header), ErrInvalidHeader)
+	header, err := index.decodeMeta(io.NewSectionReader(r, 0, size))
+	if err != nil {
+		return err
 	}
-	// read meta items count
-	buffer := make([]byte, metaItemsCountSize)
-	if _, err := r.Read(buffer); err != nil {
-		return fmt.Errorf("%w: %w", ErrReadMetaItemsCount, err)
+
+	blobSize := uint64(size - header.blobOffset())
+	// bytes after the previews part are left by an interrupted save
+	if header.version != legacyVersion {
+		blobSize = header.blobSize
+	}
+
+	index.source = blobSource{
+		reader: r,
+		offset: header.blobOffset(),
+		size:   blobSize,
+		header: header,
+	}
+
+	return index.migrate(header.version)
+}
+
+// header is the part of the index file before meta items.
+type header struct {
+	version        uint32
+	metaItemsCount uint32
+	metaPartSize   uint32
+	// previews part size, it's unknown (0) for legacy files
+	blobSize uint64
+	// meta part checksum, it's unknown (0) for legacy files
+	metaChecksum uint32
+	// the meta part is written in turns into one of two slots of slotSize bytes,
+	// which are followed by the previews part, so saves append previews to the file
+	metaSlot uint32
+	slotSize uint32
+}
+
+func (h header) size() int64 {
+	if h.version == legacyVersion {
+		return int64(len(indexHeader) + 2*metaItemsCountSize)
+	}
+
+	// the previews part size takes 8 bytes
+	return int64(len(indexHeader) + 10*metaItemsCountSize)
+}
+
+func (h header) metaOffset() int64 {
+	if h.version == legacyVersion {
+		return h.size()
+	}
+
+	return h.size() + int64(h.metaSlot)*int64(h.slotSize)
+}
+
+func (h header) blobOffset() int64 {
+	if h.version == legacyVersion {
+		return h.size() + int64(h.metaPartSize)
+	}
+
+	return h.size() + 2*int64(h.slotSize)
+}
+
+// write writes the header in the format of the current version, it ends with the checksum of the preceding bytes.
+func (h header) write(out io.Writer) error {
+	checksum := crc32.NewIEEE()
+	w := io.MultiWriter(out, checksum)
+
+	if _, err := w.Write([]byte(indexHeader)); err != nil {
+		return fmt.Errorf("%w: %w", ErrWriteHeader, err)
+	}
+
+	fields := []struct {
+		value []byte
+		err   error
+	}{
+		{binary.LittleEndian.AppendUint32(nil, versionMarker), ErrWriteVersion},
+		{binary.LittleEndian.AppendUint32(nil, currentVersion), ErrWriteVersion},
+		{binary.LittleEndian.AppendUint32(nil, h.metaItemsCount), ErrWriteMetaItemsCount},
+		{binary.LittleEndian.AppendUint32(nil, h.metaPartSize), ErrWriteMetaPartSize},
+		{binary.LittleEndian.AppendUint64(nil, h.blobSize), ErrWriteBlobSize},
+		{binary.LittleEndian.AppendUint32(nil, h.metaChecksum), ErrWriteMetaChecksum},
+		{binary.LittleEndian.AppendUint32(nil, h.metaSlot), ErrWriteMetaSlot},
+		{binary.LittleEndian.AppendUint32(nil, h.slotSize), ErrWriteMetaSlot},
+	}
+
+	for _, field := range fields {
+		if _, err := w.Write(field.value); err != nil {
+			return fmt.Errorf("%w: %w", field.err, err)
+		}
+	}
+
+	if _, err := out.Write(binary.LittleEndian.AppendUint32(nil, checksum.Sum32())); err != nil {
+		return fmt.Errorf("%w: %w", ErrWriteHeaderChecksum, err)
+	}
+
+	return nil
+}
+
+// readHeader returns zero header for empty r.
+func readHeader(in io.Reader) (header, error) {
+	result := header{}
+	checksum := crc32.NewIEEE()
+	r := io.TeeReader(in, checksum)
+	magic := make([]byte, len([]byte(indexHeader)))
+
+	n, err := io.ReadFull(r, magic)
+	if n == 0 && errors.Is(err, io.EOF) {
+		return result, nil
 	}
 
-	metaItemsCount := binary.LittleEndian.Uint32(buffer)
+	if err != nil {
+		return result, fmt.Errorf("%w: %w", ErrReadHeader, err)
+	}
+
+	if string(magic) != indexHeader {
+		return result, fmt.Errorf("%s is %w", string(magic), ErrInvalidHeader)
+	}
+
+	// read version, legacy files start with meta items count instead of it
+	result.version = legacyVersion
+
+	if result.metaItemsCount, err = readUint32(r, ErrReadVersion); err != nil {
+		return result, err
+	}
+
+	if result.metaItemsCount == versionMarker {
+		if result.version, err = readUint32(r, ErrReadVersion); err != nil {
+			return result, err
+		}
+
+		if err := checkVersion(result.version); err != nil {
+			return result, err
+		}
+
+		// read meta items count
+		if result.metaItemsCount, err = readUint32(r, ErrReadMetaItemsCount); err != nil {
+			return result, err
+		}
+	}
 
 	// read meta part size
-	if _, err := r.Read(buffer); err != nil {
-		return fmt.Errorf("%w: %w", ErrReadMetaPartSize, err)
+	if result.metaPartSize, err = readUint32(r, ErrReadMetaPartSize); err != nil {
+		return result, err
+	}
+
+	if result.version == legacyVersion {
+		return result, nil
+	}
+
+	// read previews part size
+	if result.blobSize, err = readUint64(r, ErrReadBlobSize); err != nil {
+		return result, err
+	}
+
+	// read meta part checksum
+	if result.metaChecksum, err = readUint32(r, ErrReadMetaChecksum); err != nil {
+		return result, err
+	}
+
+	// read meta slots
+	if result.metaSlot, err = readUint32(r, ErrReadMetaSlot); err != nil {
+		return result, err
+	}
+
+	if result.slotSize, err = readUint32(r, ErrReadMetaSlot); err != nil {
+		return result, err
+	}
+
+	// read header checksum, it isn't a part of the checksummed bytes
+	expected := checksum.Sum32()
+
+	headerChecksum, err := readUint32(in, ErrReadHeaderChecksum)
+	if err != nil {
+		return result, err
+	}
+
+	if headerChecksum != expected {
+		return result, fmt.Errorf("%w: header", ErrChecksumMismatch)
+	}
+
+	return result, nil
+}
+
+func readUint32(r io.Reader, readErr error) (uint32, error) {
+	buffer := make([]byte, metaItemsCountSize)
+	if _, err := io.ReadFull(r, buffer); err != nil {
+		return 0, fmt.Errorf("%w: %w", readErr, err)
 	}
 
-	metaItemsSize := binary.LittleEndian.Uint32(buffer)
+	return binary.LittleEndian.Uint32(buffer), nil
+}
+
+func readUint64(r io.Reader, readErr error) (uint64, error) {
+	buffer := make([]byte, 2*metaItemsCountSize)
+	if _, err := io.ReadFull(r, buffer); err != nil {
+		return 0, fmt.Errorf("%w: %w", readErr, err)
+	}
+
+	return binary.LittleEndian.Uint64(buffer), nil
+}
+
+// readMetaPart reads meta part and checks its checksum.
+func readMetaPart(r io.Reader, header header) ([]byte, error) {
+	metaPartBuffer := make([]byte, header.metaPartSize)
+	if _, err := io.ReadFull(r, metaPartBuffer); err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrReadMetaPart, err)
+	}
+
+	if header.version != legacyVersion && crc32.ChecksumIEEE(metaPartBuffer) != header.metaChecksum {
+		return nil, fmt.Errorf("%w: meta part", ErrChecksumMismatch)
+	}
+
+	return metaPartBuffer, nil
+}
+
+// decodeMeta reads header and meta part, the index has to be migrated after the binary data is available.
+func (index *Index) decodeMeta(r io.Reader) (header, error) {
+	header, err := readHeader(r)
+	if err != nil {
+		return header, err
+	}
+
+	if header.version == 0 {
+		return header, nil
+	}
+
+	if err := skip(r, header.metaOffset()-header.size(), ErrReadMetaPart); err != nil {
+		return header, err
+	}
 
 	// read meta
-	metaPartBuffer := make([]byte, metaItemsSize)
-	if _, err = r.Read(metaPartBuffer); err != nil {
-		return fmt.Errorf("%w: %w", ErrReadMetaPart, err)
+	metaPartBuffer, err := readMetaPart(r, header)
+	if err != nil {
+		return header, err
+	}
+
+	if err := index.metaDecode(bytes.NewReader(metaPartBuffer), header.metaItemsCount); err != nil {
+		return header, fmt.Errorf("%w: %w", ErrMetaDecode, err)
+	}
+
+	return header, nil
+}
+
+// readBlob reads the previews part, which follows the meta part.
+func readBlob(r io.Reader, header header) ([]byte, error) {
+	// legacy files end with the previews part
+	if header.version == legacyVersion {
+		data, err := io.ReadAll(r)
+		if err != nil {
+			return nil, fmt.Errorf("%w: %w", ErrReadBinaryData, err)
+		}
+
+		return data, nil
 	}
 
-	if err := index.metaDecode(bytes.NewReader(metaPartBuffer), metaItemsCount); err != nil {
-		return fmt.Errorf("%w: %w", ErrMetaDecode, err)
+	if err := skip(r, header.blobOffset()-header.metaOffset()-int64(header.metaPartSize), ErrReadBinaryData); err != nil {
+		return nil, err
 	}
 
-	// read binary data
-	if index.data, err = io.ReadAll(r); err != nil {
-		return fmt.Errorf("%w: %w", ErrReadBinaryData, err)
+	data := make([]byte, header.blobSize)
+	if _, err := io.ReadFull(r, data); err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrReadBinaryData, err)
+	}
+
+	return data, nil
+}
+
+func skip(r io.Reader, count int64, readErr error) error {
+	if _, err := io.CopyN(io.Discard, r, count); err != nil {
+		return fmt.Errorf("%w: %w", readErr, err)
 	}
 
 	return nil
 }
 
+// Encode writes the whole index file.
 func (index *Index) Encode(w io.Writer) (uint64, error) {
-	// write header
-	writer := bytesutil.NewWriterCounter(w)
-	if _, err := writer.Write([]byte(indexHeader)); err != nil {
-		return 0, fmt.Errorf("%w: %w", ErrWriteHeader, err)
+	index.saving.Lock()
+	defer index.saving.Unlock()
+
+	state, err := index.snapshot()
+	if err != nil {
+		return 0, err
 	}
-	// write meta items count
-	buffer := make([]byte, metaItemsCountSize)
-	binary.LittleEndian.PutUint32(buffer, uint32(len(index.meta)))
 
-	if _, err := writer.Write(buffer); err != nil {
-		return 0, fmt.Errorf("%w: %w", ErrWriteMetaItemsCount, err)
+	return state.encode(w)
+}
+
+// snapshot is the state of the index, which is written by a save.
+type snapshot struct {
+	meta  []byte
+	count uint32
+	// source is the previews part of the file, which the index is read from,
+	// data are the previews added after it
+	source blobSource
+	data   []byte
+}
+
+func (index *Index) snapshot() (snapshot, error) {
+	index.mu.RLock()
+	defer index.mu.RUnlock()
+
+	meta, err := encodeMeta(index.meta)
+	if err != nil {
+		return snapshot{}, err
 	}
-	// prepare meta items
-	metaBuffer := bytes.NewBuffer(make([]byte, 0))
 
-	if err := index.metaEncode(metaBuffer); err != nil {
-		return 0, fmt.Errorf("%w: %w", ErrMetaDecode, err)
+	return snapshot{
+		meta:   meta,
+		count:  uint32(len(index.meta)),
+		source: index.source,
+		data:   index.data,
+	}, nil
+}
+
+func (s snapshot) header() header {
+	return newHeader(s.meta, s.count, s.source.size+uint64(len(s.data)))
+}
+
+// blob returns the reader of the previews part.
+func (s snapshot) blob() io.Reader {
+	return io.MultiReader(
+		io.NewSectionReader(s.source.reader, s.source.offset, int64(s.source.size)),
+		bytes.NewReader(s.data),
+	)
+}
+
+func (s snapshot) encode(w io.Writer) (uint64, error) {
+	return encodeFile(w, s.header(), s.meta, s.blob())
+}
+
+// newHeader returns the header of a new file, its meta part takes the first slot.
+func newHeader(meta []byte, count uint32, blobSize uint64) header {
+	return header{
+		version:        currentVersion,
+		metaItemsCount: count,
+		metaPartSize:   uint32(len(meta)),
+		blobSize:       blobSize,
+		metaChecksum:   crc32.ChecksumIEEE(meta),
+		slotSize:       uint32(max(minMetaSlotSize, 2*len(meta))),
 	}
+}
 
-	// write meta part size
-	binary.LittleEndian.PutUint32(buffer, uint32(metaBuffer.Len()))
+// encodeFile writes a new file, the previews part is copied from the blob reader.
+func encodeFile(w io.Writer, header header, meta []byte, blob io.Reader) (uint64, error) {
+	writer := bytesutil.NewWriterCounter(w)
 
-	if _, err := writer.Write(buffer); err != nil {
-		return 0, fmt.Errorf("%w: %w", ErrWriteMetaPartSize, err)
+	if err := header.write(writer); err != nil {
+		return 0, err
 	}
 
-	// write meta part
-	if _, err := writer.Write(metaBuffer.Bytes()); err != nil {
+	// the rest of the first slot and the second one are empty
+	slots := make([]byte, 2*header.slotSize)
+	copy(slots, meta)
+
+	if _, err := writer.Write(slots); err != nil {
 		return 0, fmt.Errorf("%w: %w", ErrWriteMetaPart, err)
 	}
-	// write binary data
-	if _, err := writer.Write(index.data); err != nil {
+
+	if _, err := io.CopyN(writer, blob, int64(header.blobSize)); err != nil {
 		return 0, fmt.Errorf("%w: %w", ErrWriteBinaryData, err)
 	}
 
 	return writer.Count(), nil
 }
 
-func (index *Index) metaEncode(w io.Writer) error {
+func encodeMeta(meta map[ID]*Meta) ([]byte, error) {
+	metaBuffer := bytes.NewBuffer(make([]byte, 0))
+
+	if err := metaEncode(metaBuffer, meta); err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrMetaEncode, err)
+	}
+
+	return metaBuffer.Bytes(), nil
+}
+
+func metaEncode(w io.Writer, meta map[ID]*Meta) error {
 	gzipEncoder := gzip.NewWriter(w)
 	jsonEncoder := json.NewEncoder(gzipEncoder)
 
-	for _, v := range index.meta {
+	for _, v := range meta {
 		err := jsonEncoder.Encode(v)
 		if err != nil {
 			return fmt.Errorf("%w: %w", ErrJSONEncode, err)
@@ -164,6 +491,7 @@ func (index *Index) metaDecode(r io.Reader, count uint32) error {
 			return fmt.Errorf("%w: %w", ErrMetaItemDecode, err)
 		}
 
+		index.resolvePath(&m)
 		index.meta[m.ID] = &m
 	}
 
@@ -0,0 +1,247 @@
+package index
+
+import (
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+)
+
+var ErrContentHash = errors.New("failed to hash file content")
+
+const (
+	// size of the file parts (head and tail), which are hashed for the content identity
+	contentHashPartSize = 64 * 1024
+	contentHashSize     = 16
+)
+
+// contentHash returns the hash of the file size, its head and tail, so it's fast even for large files.
+func contentHash(path string, size int64) (string, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return "", fmt.Errorf("%w: %w", ErrContentHash, err)
+	}
+	defer file.Close()
+
+	hash := sha256.New()
+	if err := binary.Write(hash, binary.LittleEndian, size); err != nil {
+		return "", fmt.Errorf("%w: %w", ErrContentHash, err)
+	}
+
+	if _, err := io.Copy(hash, io.NewSectionReader(file, 0, min(size, contentHashPartSize))); err != nil {
+		return "", fmt.Errorf("%w: %w", ErrContentHash, err)
+	}
+
+	if tailOffset := max(size-contentHashPartSize, contentHashPartSize); tailOffset < size {
+		if _, err := io.Copy(hash, io.NewSectionReader(file, tailOffset, size-tailOffset)); err != nil {
+			return "", fmt.Errorf("%w: %w", ErrContentHash, err)
+		}
+	}
+
+	return hex.EncodeToString(hash.Sum(nil)[:contentHashSize]), nil
+}
+
+// contentIdentity tracks items of the index by content, so moved, renamed and touched files
+// keep their IDs and previews.
+type contentIdentity struct {
+	index     *Index
+	exists    func(path RelativePath) bool
+	hashes    map[string]*Meta
+	ids       *idClaims
+	postponed func(m *Meta) bool
+}
+
+func newContentIdentity(
+	index *Index,
+	exists func(path RelativePath) bool,
+	ids *idClaims,
+	postponed func(m *Meta) bool,
+) contentIdentity {
+	identity := contentIdentity{
+		index:     index,
+		exists:    exists,
+		hashes:    make(map[string]*Meta, len(index.meta)),
+		ids:       ids,
+		postponed: postponed,
+	}
+
+	for _, m := range index.meta {
+		if m.ContentHash != "" {
+			identity.hashes[m.ContentHash] = m
+		}
+	}
+
+	return identity
+}
+
+// pendingMeta works like indexBuilder.pendingMeta, but identifies files by content,
+// the item is hashed by hash before.
+func (ci *contentIdentity) pendingMeta(metaItem *Meta) *Meta {
+	saved, ok := ci.index.paths[metaItem.RelativePath]
+
+	// directories are identified by path, so their IDs don't depend on content changes
+	if metaItem.IsDir {
+		if ok && saved.IsDir {
+			ci.ids.claim(saved)
+
+			if !saved.ModTime.Equal(metaItem.ModTime) {
+				ci.update(saved, func(m *Meta) { m.ModTime = metaItem.ModTime })
+			}
+
+			return nil
+		}
+
+		metaItem.generatePathID()
+
+		return ci.newMeta(metaItem, saved)
+	}
+
+	if ok && unchanged(saved, metaItem) {
+		if saved.ContentHash == "" && metaItem.ContentHash != "" {
+			saved = ci.update(saved, func(m *Meta) { m.ContentHash = metaItem.ContentHash })
+		}
+
+		return ci.reuse(saved, metaItem)
+	}
+
+	if metaItem.ContentHash == "" {
+		return ci.newMeta(metaItem, saved)
+	}
+
+	// the file has been moved, renamed or touched
+	if moved, ok := ci.hashes[metaItem.ContentHash]; ok && (moved == saved || ci.movable(moved)) {
+		slog.Debug(
+			"The file is moved",
+			slog.String("from", string(moved.RelativePath)),
+			slog.String("to", string(metaItem.RelativePath)),
+		)
+
+		if saved != nil && saved != moved {
+			ci.forget(saved)
+		}
+
+		moved = ci.update(moved, func(m *Meta) {
+			m.RelativePath = metaItem.RelativePath
+			m.AbsolutePath = metaItem.AbsolutePath
+			m.Name = metaItem.Name
+			m.ModTime = metaItem.ModTime
+		})
+
+		return ci.reuse(moved, metaItem)
+	}
+
+	// copies of the files have the same content, they are identified by path
+	if _, copied := ci.hashes[metaItem.ContentHash]; !copied {
+		metaItem.generateContentID()
+	}
+
+	return ci.newMeta(metaItem, saved)
+}
+
+// movable reports whether the item can take a new path, it's false for copies of still existing files.
+func (ci *contentIdentity) movable(m *Meta) bool {
+	if ci.ids.isClaimed(m.ID) {
+		return false
+	}
+
+	return !ci.exists(m.RelativePath)
+}
+
+// reuse keeps the saved item, it's loaded again only if it lacks the preview.
+func (ci *contentIdentity) reuse(saved *Meta, metaItem *Meta) *Meta {
+	ci.ids.claim(saved)
+
+	if saved.Preview.Length != 0 || saved.IsOtherFile() || ci.postponed(saved) {
+		return nil
+	}
+
+	metaItem.ID = saved.ID
+	metaItem.ContentHash = saved.ContentHash
+	metaItem.Failure = saved.Failure
+
+	return metaItem
+}
+
+func (ci *contentIdentity) newMeta(metaItem *Meta, saved *Meta) *Meta {
+	// the file at the same path has been replaced
+	if saved != nil {
+		ci.forget(saved)
+	}
+
+	ci.ids.resolve(metaItem)
+	ci.ids.claim(metaItem)
+
+	if metaItem.ContentHash != "" {
+		ci.hashes[metaItem.ContentHash] = metaItem
+	}
+
+	return metaItem
+}
+
+// update replaces the item with its changed copy.
+func (ci *contentIdentity) update(m *Meta, change func(updated *Meta)) *Meta {
+	updated := *m
+	change(&updated)
+
+	ci.forget(m)
+
+	// the item at the same path is replaced by put
+	if updated.RelativePath != m.RelativePath {
+		ci.index.unlink(m)
+	}
+
+	ci.index.put(&updated)
+	ci.index.outDated = true
+
+	if updated.ContentHash != "" {
+		ci.hashes[updated.ContentHash] = &updated
+	}
+
+	return &updated
+}
+
+// forget drops the item from hashes, the replaced item stays in the index until the new version is loaded.
+func (ci *contentIdentity) forget(m *Meta) {
+	if ci.hashes[m.ContentHash] == m {
+		delete(ci.hashes, m.ContentHash)
+	}
+}
+
+// hash sets the content hash of the file, unchanged files aren't hashed again.
+// The index isn't locked, while the file is read, it's only read locked to find the saved item.
+func (ci *contentIdentity) hash(m *Meta) {
+	if m.IsDir {
+		return
+	}
+
+	ci.index.mu.RLock()
+	saved, ok := ci.index.paths[m.RelativePath]
+	known := ok && unchanged(saved, m) && saved.ContentHash != ""
+	ci.index.mu.RUnlock()
+
+	if known {
+		return
+	}
+
+	hash, err := contentHash(m.Path(), m.OriginSize)
+	if err != nil {
+		slog.Warn(
+			"The file is identified by path",
+			slog.String("path", string(m.RelativePath)),
+			slog.String("error", err.Error()),
+		)
+
+		return
+	}
+
+	m.ContentHash = hash
+}
+
+// unchanged reports whether the saved item is the same file, which hasn't been changed since it was saved.
+func unchanged(saved *Meta, m *Meta) bool {
+	return !saved.IsDir && saved.ModTime.Equal(m.ModTime) && saved.OriginSize == m.OriginSize
+}
@@ -6,33 +6,65 @@ import (
 	"io"
 	"os"
 	"path/filepath"
+	"slices"
 	"strings"
+	"sync"
 )
 
 var ErrNotFound = errors.New("not found")
 
+// Index is safe for concurrent use, its items are read by the server while the index is updated.
 type Index struct {
+	// mu guards the fields below, while the items are read or changed
+	mu       sync.RWMutex
 	meta     map[ID]*Meta
 	tree     map[ID][]*Meta
 	paths    map[RelativePath]*Meta
+	root     string
+	source   blobSource
 	data     []byte
 	outDated bool
+	// file is the index file opened by a save, previews are read from it
+	file *os.File
+	// count of ID collisions resolved while the index was built
+	collisions int
+	progress   Progress
+	// cancel stops the current loading of files
+	cancel context.CancelFunc
+	// priorities and pool have their own locks, they are changed by readers
+	priorities *priorities
+	pool       *workerPool
+	// done is closed when the files given to NewIndex are loaded, err is the result
+	done chan struct{}
+	err  error
+	// updating serializes the builder runs
+	updating sync.Mutex
+	// saving serializes writes of the index file
+	saving  sync.Mutex
+	builder *indexBuilder
 }
 
-func NewIndex(ctx context.Context, r io.Reader, opts ...Option) (Index, error) {
-	index := Index{
-		data:     []byte{},
-		meta:     map[ID]*Meta{},
-		tree:     map[ID][]*Meta{},
-		paths:    map[RelativePath]*Meta{},
-		outDated: false,
+// NewIndex decodes the index from the reader and loads the files into it.
+// With WithBackground the files are loaded after it returns, see Done.
+func NewIndex(ctx context.Context, r io.Reader, opts ...Option) (*Index, error) {
+	index := &Index{
+		data:       []byte{},
+		meta:       map[ID]*Meta{},
+		tree:       map[ID][]*Meta{},
+		paths:      map[RelativePath]*Meta{},
+		outDated:   false,
+		done:       make(chan struct{}),
+		priorities: newPriorities(),
 	}
-	builder := newBuilder(&index)
+	builder := newBuilder(index)
 
 	for _, opt := range opts {
-		opt(&builder)
+		opt(builder)
 	}
 
+	index.builder = builder
+	index.pool = newWorkerPool(builder.params.workers)
+
 	if err := builder.run(ctx, r); err != nil {
 		return index, err
 	}
@@ -40,11 +72,51 @@ func NewIndex(ctx context.Context, r io.Reader, opts ...Option) (Index, error) {
 	return index, nil
 }
 
+// Done returns a channel, which is closed when the files given to NewIndex are loaded.
+func (index *Index) Done() <-chan struct{} {
+	return index.done
+}
+
+// Err returns the error of loading the files given to NewIndex, it's nil until Done is closed.
+func (index *Index) Err() error {
+	index.mu.RLock()
+	defer index.mu.RUnlock()
+
+	return index.err
+}
+
+func (index *Index) finish(err error) {
+	index.mu.Lock()
+	index.err = err
+	index.mu.Unlock()
+
+	close(index.done)
+}
+
+// resolvePath sets the absolute path of the meta item by its path relative to the root.
+func (index *Index) resolvePath(m *Meta) {
+	m.AbsolutePath = Path(filepath.Join(index.root, string(m.RelativePath)))
+}
+
 func (index *Index) OutDated() bool {
+	index.mu.RLock()
+	defer index.mu.RUnlock()
+
 	return index.outDated
 }
 
+// Collisions returns count of ID collisions resolved while the index was built.
+func (index *Index) Collisions() int {
+	index.mu.RLock()
+	defer index.mu.RUnlock()
+
+	return index.collisions
+}
+
 func (index *Index) Pull(id ID) (*Meta, error) {
+	index.mu.RLock()
+	defer index.mu.RUnlock()
+
 	m, ok := index.meta[id]
 	if !ok {
 		return nil, ErrNotFound
@@ -54,6 +126,9 @@ func (index *Index) Pull(id ID) (*Meta, error) {
 }
 
 func (index *Index) PullPreview(id ID) ([]byte, error) {
+	index.mu.RLock()
+	defer index.mu.RUnlock()
+
 	meta, ok := index.meta[id]
 	if !ok {
 		return nil, ErrNotFound
@@ -63,10 +138,13 @@ func (index *Index) PullPreview(id ID) ([]byte, error) {
 		return nil, nil
 	}
 
-	return index.data[meta.Preview.Offset : meta.Preview.Offset+meta.Preview.Length], nil
+	return index.readPreview(meta.Preview)
 }
 
 func (index *Index) PullChildren(id ID) ([]*Meta, error) {
+	index.mu.RLock()
+	defer index.mu.RUnlock()
+
 	result := make([]*Meta, 0)
 
 	// return root children
@@ -81,18 +159,47 @@ func (index *Index) PullChildren(id ID) ([]*Meta, error) {
 	}
 
 	if children, ok := index.tree[id]; ok {
-		return children, nil
+		return slices.Clone(children), nil
 	}
 
 	return nil, ErrNotFound
 }
 
+// realPaths returns loaded items, which real path is known, by the real path.
+func (index *Index) realPaths() map[string]*Meta {
+	paths := make(map[string]*Meta)
+
+	for _, m := range index.meta {
+		if m.RealPath != "" && (m.Preview.Length != 0 || m.Failure != nil) {
+			paths[m.RealPath] = m
+		}
+	}
+
+	return paths
+}
+
+// PullDir returns the folder at the path and its children.
+func (index *Index) PullDir(path RelativePath) (*Meta, []*Meta, error) {
+	index.mu.RLock()
+	defer index.mu.RUnlock()
+
+	m, ok := index.paths[path]
+	if !ok || !m.IsDir {
+		return nil, nil, ErrNotFound
+	}
+
+	return m, slices.Clone(index.tree[m.ID]), nil
+}
+
 func (index *Index) PullPaths(id ID) ([]*Meta, error) {
 	result := []*Meta{}
 	if id == "" {
 		return result, nil
 	}
 
+	index.mu.RLock()
+	defer index.mu.RUnlock()
+
 	m, ok := index.meta[id]
 	if !ok || !m.IsDir {
 		return nil, ErrNotFound
@@ -120,6 +227,9 @@ func (index *Index) PullPaths(id ID) ([]*Meta, error) {
 }
 
 func (index *Index) Search(query string, dirID ID) []*Meta {
+	index.mu.RLock()
+	defer index.mu.RUnlock()
+
 	result := []*Meta{}
 	query = strings.ToLower(query)
 	filter := func(v *Meta) {
@@ -148,9 +258,12 @@ func (index *Index) Search(query string, dirID ID) []*Meta {
 	return result
 }
 
-func (index *Index) FilesWithPreviewStat() (int, int, uint32) {
+func (index *Index) FilesWithPreviewStat() (int, int, uint64) {
+	index.mu.RLock()
+	defer index.mu.RUnlock()
+
 	count := 0
-	size := uint32(0)
+	size := uint64(0)
 
 	for _, v := range index.meta {
 		if v.Preview.Length != 0 {
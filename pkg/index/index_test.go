@@ -5,6 +5,7 @@ import (
 	"bytes"
 	"context"
 	"crypto/rand"
+	"encoding/binary"
 	"io/fs"
 	"os"
 	"path/filepath"
@@ -25,7 +26,7 @@ func TestIndexEncodeDecode(t *testing.T) {
 
 	indexOriginal.meta = map[ID]*Meta{
 		"5762029e772": {
-			AbsolutePath: "/home/test/",
+			AbsolutePath: "/home/test",
 			Name:         "test",
 			ID:           "5762029e772",
 			RelativePath: "test/",
@@ -57,12 +58,194 @@ func TestIndexEncodeDecode(t *testing.T) {
 	assert.NotEqualValues(t, 0, wrote)
 	assert.NotEqualValues(t, 0, buff.Len())
 	// Parse
-	indexDerivative, err := NewIndex(context.Background(), bufio.NewReader(buff))
+	indexDerivative, err := NewIndex(context.Background(), bufio.NewReader(buff), WithRoot("/home"))
 	require.NoError(t, err)
 	assert.Len(t, indexDerivative.meta, len(indexOriginal.meta))
 	assert.Equal(t, indexOriginal.meta, indexDerivative.meta)
 	assert.Len(t, indexDerivative.data, len(indexOriginal.data))
 	assert.Equal(t, indexOriginal.data, indexDerivative.data)
+	assert.False(t, indexDerivative.OutDated())
+}
+
+func TestIndexRelocation(t *testing.T) {
+	t.Parallel()
+	require := require.New(t)
+
+	indexOriginal, err := NewIndex(context.Background(), nil, WithRoot("/home"))
+	require.NoError(err)
+
+	indexOriginal.meta = map[ID]*Meta{
+		"2cf24dba5fb": {
+			AbsolutePath: "/home/test/abc.jpg",
+			Name:         "abc.jpg",
+			ID:           "2cf24dba5fb",
+			RelativePath: "test/abc.jpg",
+			ModTime:      time.Date(2024, 11, 5, 5, 5, 5, 0, time.UTC),
+			Type:         ContentTypeImage,
+		},
+	}
+
+	buff := new(bytes.Buffer)
+	_, err = indexOriginal.Encode(buff)
+	require.NoError(err)
+
+	// the root has been moved
+	indexMoved, err := NewIndex(context.Background(), buff, WithRoot("/mnt/media"))
+	require.NoError(err)
+
+	meta, err := indexMoved.Pull("2cf24dba5fb")
+	require.NoError(err)
+	require.Equal("/mnt/media/test/abc.jpg", meta.Path())
+}
+
+func TestIndexUnsupportedVersion(t *testing.T) {
+	t.Parallel()
+
+	buff := bytes.NewBufferString(indexHeader)
+	require.NoError(t, binary.Write(buff, binary.LittleEndian, []uint32{versionMarker, currentVersion + 1, 0, 0}))
+
+	_, err := NewIndex(context.Background(), buff)
+	require.ErrorIs(t, err, ErrUnsupportedVersion)
+
+	buff = bytes.NewBufferString(indexHeader)
+	require.NoError(t, binary.Write(buff, binary.LittleEndian, []uint32{versionMarker, 0, 0, 0}))
+
+	_, err = NewIndex(context.Background(), buff)
+	require.ErrorIs(t, err, ErrInvalidVersion)
+	require.NotErrorIs(t, err, ErrUnsupportedVersion)
+}
+
+func TestIndexLazyPreviews(t *testing.T) {
+	t.Parallel()
+	require := require.New(t)
+
+	indexOriginal, err := NewIndex(context.Background(), nil)
+	require.NoError(err)
+
+	indexOriginal.meta = map[ID]*Meta{
+		"2cf24dba5fb": {
+			AbsolutePath: "/home/test/abc.jpg",
+			Name:         "abc.jpg",
+			ID:           "2cf24dba5fb",
+			RelativePath: "test/abc.jpg",
+			ModTime:      time.Date(2024, 11, 5, 5, 5, 5, 0, time.UTC),
+			Type:         ContentTypeImage,
+			Preview: PreviewLocation{
+				Length: 100,
+				Offset: 0,
+			},
+		},
+	}
+	indexOriginal.data = make([]byte, 100)
+	_, err = rand.Read(indexOriginal.data)
+	require.NoError(err)
+
+	buff := new(bytes.Buffer)
+	_, err = indexOriginal.Encode(buff)
+	require.NoError(err)
+
+	sampleData := make([]byte, 50)
+	_, err = rand.Read(sampleData)
+	require.NoError(err)
+
+	newFile := &mockFile{
+		relativePath: "test/new.jpg",
+		path:         "/home/test/new.jpg",
+		modTime:      time.Date(2024, 11, 6, 5, 5, 5, 0, time.UTC),
+		name:         "new.jpg",
+	}
+	indexLazy, err := NewIndex(
+		context.Background(),
+		bytes.NewReader(buff.Bytes()),
+		WithLazyPreviews(),
+		WithFiles([]FileMeta{newFile}),
+		WithPreview(mockPreviewGenerator{sampleData: sampleData}),
+	)
+	require.NoError(err)
+	require.Len(indexLazy.meta, 2)
+	require.Len(indexLazy.data, len(sampleData))
+
+	original, err := indexLazy.PullPreview("2cf24dba5fb")
+	require.NoError(err)
+	require.Equal(indexOriginal.data, original)
+
+	newMeta := indexLazy.paths["test/new.jpg"]
+	require.NotNil(newMeta)
+	require.EqualValues(100, newMeta.Preview.Offset)
+
+	appended, err := indexLazy.PullPreview(newMeta.ID)
+	require.NoError(err)
+	require.Equal(sampleData, appended)
+
+	// saved index contains both, the lazily read and the appended previews
+	savedBuff := new(bytes.Buffer)
+	_, err = indexLazy.Encode(savedBuff)
+	require.NoError(err)
+
+	indexDerivative, err := NewIndex(context.Background(), bufio.NewReader(savedBuff))
+	require.NoError(err)
+	require.Equal(append(indexOriginal.data, sampleData...), indexDerivative.data)
+}
+
+func TestIndexVerify(t *testing.T) {
+	t.Parallel()
+	require := require.New(t)
+
+	indexOriginal, err := NewIndex(context.Background(), nil)
+	require.NoError(err)
+
+	data := make([]byte, 100)
+	_, err = rand.Read(data)
+	require.NoError(err)
+
+	indexOriginal.meta = map[ID]*Meta{
+		"2cf24dba5fb": {
+			Name:         "abc.jpg",
+			ID:           "2cf24dba5fb",
+			RelativePath: "test/abc.jpg",
+			Type:         ContentTypeImage,
+			Preview:      indexOriginal.appendPreview(data),
+		},
+	}
+
+	buff := new(bytes.Buffer)
+	_, err = indexOriginal.Encode(buff)
+	require.NoError(err)
+
+	encoded := buff.Bytes()
+
+	index, err := NewIndex(context.Background(), bytes.NewReader(encoded), WithLazyPreviews())
+	require.NoError(err)
+	require.Empty(index.Verify())
+
+	// damaged preview
+	damaged := bytes.Clone(encoded)
+	damaged[len(damaged)-1]++
+
+	index, err = NewIndex(context.Background(), bytes.NewReader(damaged), WithLazyPreviews())
+	require.NoError(err)
+
+	corrupted := index.Verify()
+	require.Len(corrupted, 1)
+	require.Equal(ID("2cf24dba5fb"), corrupted[0].ID)
+
+	index.DropPreviews(corrupted)
+	require.Empty(index.Verify())
+	require.True(index.OutDated())
+
+	// damaged meta part
+	damaged = bytes.Clone(encoded)
+	damaged[header{version: currentVersion}.size()]++
+
+	_, err = NewIndex(context.Background(), bytes.NewReader(damaged))
+	require.ErrorIs(err, ErrChecksumMismatch)
+
+	// damaged header
+	damaged = bytes.Clone(encoded)
+	damaged[len(indexHeader)+4*metaItemsCountSize]++
+
+	_, err = NewIndex(context.Background(), bytes.NewReader(damaged))
+	require.ErrorIs(err, ErrChecksumMismatch)
 }
 
 type mockFile struct {
@@ -121,6 +304,15 @@ func (m mockPreviewData) Duration() time.Duration {
 	return 0
 }
 
+func (m mockPreviewData) Codec() string {
+	return ""
+}
+
+//nolint:ireturn
+func (mock mockPreviewGenerator) Probe(_ context.Context, _ preview.Source) (preview.Probe, error) {
+	return mockPreviewData{}, nil
+}
+
 //nolint:ireturn
 func (mock mockPreviewGenerator) Pull(_ context.Context, _ preview.Source) (preview.Data, error) {
 	return mockPreviewData{data: mock.sampleData}, nil
@@ -8,6 +8,8 @@ import (
 	"slices"
 	"strings"
 	"time"
+
+	"github.com/alxarno/tinytune/pkg/preview"
 )
 
 const (
@@ -18,13 +20,19 @@ const (
 	ContentTypeDir
 )
 
+// sizes of ID and its extension for resolving collisions, in bytes of the digest.
+const (
+	idSize          = 5
+	idExtensionSize = 3
+)
+
 type ID string
 type Path string
 type RelativePath string
 
 type Meta struct {
 	ID           ID              `json:"id"`
-	AbsolutePath Path            `json:"absolutePath"`
+	AbsolutePath Path            `json:"-"`
 	RelativePath RelativePath    `json:"relativePath"`
 	OriginSize   int64           `json:"originSize"`
 	Name         string          `json:"name"`
@@ -35,11 +43,19 @@ type Meta struct {
 	Resolution   Resolution      `json:"resolution"`
 	Extension    string          `json:"extension"`
 	Type         int             `json:"type"`
+	Codec        string          `json:"codec"`
+	ContentHash  string          `json:"contentHash"`
+	Failure      *Failure        `json:"failure,omitempty"`
+	// RealPath is the path of the file with symbolic links resolved, items with the same one share the preview
+	RealPath string `json:"realPath,omitempty"`
+	// idDigest is the hex digest, which ID is the prefix of
+	idDigest string
 }
 
 type PreviewLocation struct {
-	Length uint32 `json:"length"`
-	Offset uint32 `json:"offset"`
+	Length   uint64 `json:"length"`
+	Offset   uint64 `json:"offset"`
+	Checksum uint32 `json:"checksum"`
 }
 
 type Resolution struct {
@@ -67,14 +83,73 @@ func (m *Meta) IsOtherFile() bool {
 	return m.Type == ContentTypeOther
 }
 
+// Probed returns media information of the video, which is probed already, so it isn't probed again for the preview.
+//
+//nolint:ireturn
+func (m *Meta) Probed() (preview.Probe, bool) {
+	return metaProbe{m}, m.IsVideo() && m.Codec != "" && m.Duration != 0
+}
+
+// metaProbe is the probed media information of the item.
+type metaProbe struct {
+	meta *Meta
+}
+
+func (p metaProbe) Duration() time.Duration {
+	return p.meta.Duration
+}
+
+func (p metaProbe) Resolution() (int, int) {
+	return p.meta.Resolution.Width, p.meta.Resolution.Height
+}
+
+func (p metaProbe) Codec() string {
+	return p.meta.Codec
+}
+
+// Path returns the absolute path of the item, it isn't stored in the index file,
+// but resolved against the current root, so the root can be moved.
 func (m *Meta) Path() string {
 	return string(m.AbsolutePath)
 }
 
+// sameFile reports whether the items have the same real path and the file hasn't changed between them.
+func (m *Meta) sameFile(other *Meta) bool {
+	return m.RealPath == other.RealPath && m.ModTime.Equal(other.ModTime) && m.OriginSize == other.OriginSize
+}
+
 func (m *Meta) generateID() {
 	idSource := []byte(fmt.Sprintf("%s%d", m.RelativePath, m.ModTime.Unix()))
 	fileID := sha256.Sum256(idSource)
-	m.ID = ID(hex.EncodeToString(fileID[:5]))
+	m.setID(hex.EncodeToString(fileID[:]))
+}
+
+// generatePathID generates ID, which doesn't change while the item stays at the same path.
+func (m *Meta) generatePathID() {
+	fileID := sha256.Sum256([]byte(m.RelativePath))
+	m.setID(hex.EncodeToString(fileID[:]))
+}
+
+// generateContentID generates ID, which doesn't change while the item has the same content.
+func (m *Meta) generateContentID() {
+	m.setID(m.ContentHash)
+}
+
+func (m *Meta) setID(digest string) {
+	m.idDigest = digest
+	m.ID = ID(digest[:2*idSize])
+}
+
+// extendID makes ID longer with the next part of the digest, it's used to resolve collisions.
+func (m *Meta) extendID() bool {
+	size := len(m.ID) + 2*idExtensionSize
+	if size > len(m.idDigest) {
+		return false
+	}
+
+	m.ID = ID(m.idDigest[:size])
+
+	return true
 }
 
 func (m *Meta) setContentType() {
@@ -1,5 +1,7 @@
 package index
 
+import "time"
+
 type Option func(*indexBuilder)
 
 func WithPreview(gen PreviewGenerator) Option {
@@ -14,6 +16,14 @@ func WithFiles(files []FileMeta) Option {
 	}
 }
 
+// WithScan makes the files be listed by the function, once the index is decoded, instead of given by WithFiles.
+// The function gets the decoded index, e.g. to take folders unchanged since the last indexing from it.
+func WithScan(scan func(decoded *Index) ([]FileMeta, error)) Option {
+	return func(i *indexBuilder) {
+		i.params.scan = scan
+	}
+}
+
 func WithProgress(f func()) Option {
 	return func(i *indexBuilder) {
 		i.params.progress = f
@@ -32,8 +42,60 @@ func WithWorkers(w int) Option {
 	}
 }
 
+// WithRoot sets the directory, which paths of the index items are relative to.
+func WithRoot(path string) Option {
+	return func(i *indexBuilder) {
+		i.index.root = path
+	}
+}
+
 func WithRemovedFilesCleaning() Option {
 	return func(i *indexBuilder) {
 		i.params.cleanRemovedFiles = true
 	}
 }
+
+// WithRetryFailed makes files, which previews failed to be produced, processed again without waiting for the backoff.
+func WithRetryFailed() Option {
+	return func(i *indexBuilder) {
+		i.params.retryFailed = true
+	}
+}
+
+// WithContentIdentity makes files identified by their size and partial content hash instead of path and
+// modification time, so moved, renamed and touched files keep their IDs and previews.
+// Directories are identified by path.
+func WithContentIdentity() Option {
+	return func(i *indexBuilder) {
+		i.params.contentIdentity = true
+	}
+}
+
+// WithLazyPreviews makes the index read previews from the index file on demand,
+// instead of loading them into memory. The reader passed to NewIndex has to implement
+// io.ReaderAt and io.Seeker, and stay open while the index is used.
+func WithLazyPreviews() Option {
+	return func(i *indexBuilder) {
+		i.params.lazy = true
+	}
+}
+
+// WithBackground makes NewIndex return once the index is decoded, the files are loaded in background.
+// The index is read meanwhile, new files are listed without previews until they are loaded.
+func WithBackground() Option {
+	return func(i *indexBuilder) {
+		i.params.background = true
+	}
+}
+
+// WithCheckpoint makes the builder save the index with the save function while previews are produced:
+// each time the interval has passed or the count of new previews has been reached (zero disables the limit).
+func WithCheckpoint(interval time.Duration, previews int, save func(index *Index) error) Option {
+	return func(i *indexBuilder) {
+		i.params.checkpoint = checkpointParams{
+			interval: interval,
+			previews: previews,
+			save:     save,
+		}
+	}
+}
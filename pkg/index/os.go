@@ -11,6 +11,12 @@ type FileMeta interface {
 	Size() int64
 }
 
+// ResolvedFile is the file, which real path is known, e.g. when symbolic links are followed.
+// Files with the same real path are processed once.
+type ResolvedFile interface {
+	RealPath() string
+}
+
 func metaByFile(file FileMeta) *Meta {
 	metaItem := &Meta{
 		AbsolutePath: Path(file.Path()),
@@ -20,6 +26,10 @@ func metaByFile(file FileMeta) *Meta {
 		OriginSize:   file.Size(),
 		IsDir:        file.IsDir(),
 	}
+	if resolved, ok := file.(ResolvedFile); ok {
+		metaItem.RealPath = resolved.RealPath()
+	}
+
 	metaItem.generateID()
 	metaItem.setContentType()
 
@@ -0,0 +1,86 @@
+package index
+
+import (
+	"context"
+	"sync"
+)
+
+// workerPool limits the count of files loaded at the same time,
+// the limit is changed and the loading is paused while the index is built.
+type workerPool struct {
+	mu     sync.Mutex
+	cond   *sync.Cond
+	limit  int
+	busy   int
+	paused bool
+}
+
+func newWorkerPool(limit int) *workerPool {
+	pool := &workerPool{limit: max(limit, 1)}
+	pool.cond = sync.NewCond(&pool.mu)
+
+	return pool
+}
+
+// acquire waits for a free worker, it returns the context error if the context is done meanwhile.
+func (p *workerPool) acquire(ctx context.Context) error {
+	stop := context.AfterFunc(ctx, func() {
+		p.mu.Lock()
+		defer p.mu.Unlock()
+
+		p.cond.Broadcast()
+	})
+	defer stop()
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	for p.paused || p.busy >= p.limit {
+		if err := ctx.Err(); err != nil {
+			return err //nolint:wrapcheck
+		}
+
+		p.cond.Wait()
+	}
+
+	if err := ctx.Err(); err != nil {
+		return err //nolint:wrapcheck
+	}
+
+	p.busy++
+
+	return nil
+}
+
+func (p *workerPool) release() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	p.busy--
+	p.cond.Broadcast()
+}
+
+// setPaused pauses or resumes the loading, the files already being loaded are finished.
+func (p *workerPool) setPaused(paused bool) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	p.paused = paused
+	p.cond.Broadcast()
+}
+
+// setLimit changes the count of workers, the extra ones stop after their current files.
+func (p *workerPool) setLimit(limit int) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	p.limit = max(limit, 1)
+	p.cond.Broadcast()
+}
+
+func (p *workerPool) state() (bool, int) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	return p.paused, p.limit
+}
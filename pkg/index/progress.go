@@ -0,0 +1,26 @@
+package index
+
+// Progress is the count of files loaded into the index out of the files given to it,
+// with the state of the loading.
+type Progress struct {
+	Done    int  `json:"done"`
+	Total   int  `json:"total"`
+	Paused  bool `json:"paused"`
+	Workers int  `json:"workers"`
+}
+
+// Active reports whether the files are still being loaded.
+func (p Progress) Active() bool {
+	return p.Done < p.Total
+}
+
+// Progress returns the progress of loading files given to NewIndex and Update.
+func (index *Index) Progress() Progress {
+	index.mu.RLock()
+	progress := index.progress
+	index.mu.RUnlock()
+
+	progress.Paused, progress.Workers = index.pool.state()
+
+	return progress
+}
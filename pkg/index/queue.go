@@ -0,0 +1,162 @@
+package index
+
+import (
+	"container/heap"
+	"maps"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// files modified within the period are loaded first, the most recent ones go first.
+const recentPeriod = 7 * 24 * time.Hour
+
+// priorities are the folders opened by users, their files are loaded before others.
+type priorities struct {
+	mu sync.Mutex
+	// the folder opened later has the greater value
+	dirs    map[RelativePath]uint64
+	version uint64
+}
+
+func newPriorities() *priorities {
+	return &priorities{dirs: map[RelativePath]uint64{}}
+}
+
+func (p *priorities) boost(dir RelativePath) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	p.version++
+	p.dirs[dir] = p.version
+}
+
+// since returns a copy of the folders if they have changed since the version.
+func (p *priorities) since(version uint64) (map[RelativePath]uint64, uint64, bool) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.version == version {
+		return nil, version, false
+	}
+
+	return maps.Clone(p.dirs), p.version, true
+}
+
+// loadQueue orders the items to load: files of the folders opened by users go first,
+// then recently modified files and then the rest from shallow folders to deep ones.
+type loadQueue struct {
+	items      []*Meta
+	priorities *priorities
+	dirs       map[RelativePath]uint64
+	version    uint64
+	recent     time.Time
+}
+
+func newLoadQueue(items []*Meta, priorities *priorities) *loadQueue {
+	queue := &loadQueue{
+		items:      append([]*Meta{}, items...),
+		priorities: priorities,
+		dirs:       map[RelativePath]uint64{},
+		recent:     time.Now().Add(-recentPeriod),
+	}
+
+	queue.refresh()
+	heap.Init(queue)
+
+	return queue
+}
+
+// pop returns the item to load next, false if the queue is empty.
+func (q *loadQueue) pop() (*Meta, bool) {
+	if len(q.items) == 0 {
+		return nil, false
+	}
+
+	if q.refresh() {
+		heap.Init(q)
+	}
+
+	m, _ := heap.Pop(q).(*Meta)
+
+	return m, true
+}
+
+// refresh takes the folders opened since the last call, it reports whether they have changed.
+func (q *loadQueue) refresh() bool {
+	dirs, version, changed := q.priorities.since(q.version)
+	if changed {
+		q.dirs, q.version = dirs, version
+	}
+
+	return changed
+}
+
+func (q *loadQueue) Len() int {
+	return len(q.items)
+}
+
+func (q *loadQueue) Less(i, j int) bool {
+	a, b := q.items[i], q.items[j]
+
+	if openedA, openedB := q.dirs[parentPath(a.RelativePath)], q.dirs[parentPath(b.RelativePath)]; openedA != openedB {
+		return openedA > openedB
+	}
+
+	recentA, recentB := a.ModTime.After(q.recent), b.ModTime.After(q.recent)
+	if recentA != recentB {
+		return recentA
+	}
+
+	if recentA && !a.ModTime.Equal(b.ModTime) {
+		return a.ModTime.After(b.ModTime)
+	}
+
+	if depthA, depthB := depth(a.RelativePath), depth(b.RelativePath); depthA != depthB {
+		return depthA < depthB
+	}
+
+	return a.RelativePath < b.RelativePath
+}
+
+func (q *loadQueue) Swap(i, j int) {
+	q.items[i], q.items[j] = q.items[j], q.items[i]
+}
+
+func (q *loadQueue) Push(x any) {
+	if m, ok := x.(*Meta); ok {
+		q.items = append(q.items, m)
+	}
+}
+
+func (q *loadQueue) Pop() any {
+	last := q.items[len(q.items)-1]
+	q.items = q.items[:len(q.items)-1]
+
+	return last
+}
+
+func depth(path RelativePath) int {
+	return strings.Count(string(path), string(os.PathSeparator))
+}
+
+// Prioritize makes the files of the folder loaded before others, e.g. when the folder is opened by the user.
+// The empty ID is the root folder.
+func (index *Index) Prioritize(dirID ID) {
+	dir := RelativePath(".")
+
+	if dirID != "" {
+		index.mu.RLock()
+		m, ok := index.meta[dirID]
+		index.mu.RUnlock()
+
+		if !ok || !m.IsDir {
+			return
+		}
+
+		dir = m.RelativePath
+	}
+
+	index.priorities.boost(dir)
+}
@@ -0,0 +1,47 @@
+package index
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestLoadQueue(t *testing.T) {
+	t.Parallel()
+	require := require.New(t)
+
+	old := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+	now := time.Now()
+	items := []*Meta{
+		{RelativePath: "a/b/c.mp4", ModTime: old},
+		{RelativePath: "a/d.mp4", ModTime: old},
+		{RelativePath: "e.mp4", ModTime: old},
+		{RelativePath: "a/b/f.mp4", ModTime: now.Add(-time.Hour)},
+		{RelativePath: "g.mp4", ModTime: now.Add(-time.Minute)},
+		{RelativePath: "a/b/h.mp4", ModTime: old},
+	}
+	priorities := newPriorities()
+	queue := newLoadQueue(items, priorities)
+
+	pop := func() RelativePath {
+		m, ok := queue.pop()
+		require.True(ok)
+
+		return m.RelativePath
+	}
+
+	// recently modified files go first, then shallow folders
+	require.Equal(RelativePath("g.mp4"), pop())
+	require.Equal(RelativePath("a/b/f.mp4"), pop())
+	require.Equal(RelativePath("e.mp4"), pop())
+
+	// the opened folder goes before others
+	priorities.boost("a/b")
+	require.Equal(RelativePath("a/b/c.mp4"), pop())
+	require.Equal(RelativePath("a/b/h.mp4"), pop())
+	require.Equal(RelativePath("a/d.mp4"), pop())
+
+	_, ok := queue.pop()
+	require.False(ok)
+}
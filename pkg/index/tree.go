@@ -0,0 +1,96 @@
+package index
+
+import (
+	"path/filepath"
+	"slices"
+)
+
+const rootID ID = "root"
+
+func parentPath(path RelativePath) RelativePath {
+	return RelativePath(filepath.Dir(string(path)))
+}
+
+// parentID returns the tree key of the item's parent, false if the parent isn't indexed.
+func (index *Index) parentID(m *Meta) (ID, bool) {
+	parent := parentPath(m.RelativePath)
+	if parent == "." {
+		return rootID, true
+	}
+
+	dir, ok := index.paths[parent]
+	if !ok || !dir.IsDir {
+		return "", false
+	}
+
+	return dir.ID, true
+}
+
+// put adds the item into meta, paths and tree, the item with the same path is replaced.
+// Items are never changed after they are put, they are replaced by updated copies,
+// so the ones already pulled by readers stay consistent.
+func (index *Index) put(m *Meta) {
+	if old, ok := index.paths[m.RelativePath]; ok {
+		if old == m {
+			return
+		}
+
+		switch {
+		case old.IsDir && m.IsDir:
+			children, hasChildren := index.tree[old.ID]
+			index.unlink(old)
+
+			if hasChildren {
+				index.tree[m.ID] = children
+			}
+		case old.IsDir:
+			index.drop(old)
+		default:
+			index.unlink(old)
+		}
+	}
+
+	index.meta[m.ID] = m
+	index.paths[m.RelativePath] = m
+
+	if parent, ok := index.parentID(m); ok {
+		index.tree[parent] = append(index.tree[parent], m)
+	}
+}
+
+// list puts a copy of the item, which is being loaded, so it's shown without preview until it's loaded.
+// The item already indexed at the path, e.g. the old version of a modified file, is kept until then.
+func (index *Index) list(m *Meta) {
+	if _, ok := index.paths[m.RelativePath]; ok {
+		return
+	}
+
+	listed := *m
+	index.put(&listed)
+}
+
+// unlink removes the item from meta, paths and its parent's children, the item's children stay.
+func (index *Index) unlink(m *Meta) {
+	if index.meta[m.ID] == m {
+		delete(index.meta, m.ID)
+	}
+
+	if index.paths[m.RelativePath] == m {
+		delete(index.paths, m.RelativePath)
+	}
+
+	delete(index.tree, m.ID)
+
+	if parent, ok := index.parentID(m); ok {
+		index.tree[parent] = slices.DeleteFunc(index.tree[parent], func(child *Meta) bool { return child == m })
+	}
+}
+
+// drop removes the item with all its children.
+func (index *Index) drop(m *Meta) {
+	for _, child := range slices.Clone(index.tree[m.ID]) {
+		index.drop(child)
+	}
+
+	index.unlink(m)
+}
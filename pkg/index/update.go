@@ -0,0 +1,79 @@
+package index
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+)
+
+// Update loads the files into the built index, the same way as files given by WithFiles:
+// new and modified files get items with previews, unchanged ones are skipped.
+// The options of the index (preview generator, workers, identity, checkpoint) are used.
+func (index *Index) Update(ctx context.Context, files []FileMeta) error {
+	index.updating.Lock()
+	defer index.updating.Unlock()
+
+	ctx, done := index.cancelable(ctx)
+	defer done()
+
+	updater := index.updater()
+	pending := updater.pendingFiles(files, index.exists)
+
+	if err := updater.loadFiles(ctx, pending); err != nil {
+		return err
+	}
+
+	index.mu.Lock()
+	defer index.mu.Unlock()
+
+	return index.compactData()
+}
+
+// Rescan loads the files of a new scan of the data folder like Update,
+// items of the files missing in it are removed like WithRemovedFilesCleaning does.
+func (index *Index) Rescan(ctx context.Context, files []FileMeta) error {
+	index.updating.Lock()
+	defer index.updating.Unlock()
+
+	ctx, done := index.cancelable(ctx)
+	defer done()
+
+	rescan := index.updater()
+	rescan.params.files = files
+	rescan.params.cleanRemovedFiles = true
+
+	return rescan.load(ctx)
+}
+
+// updater returns the builder of the index for loading files after it's built.
+func (index *Index) updater() *indexBuilder {
+	updater := *index.builder
+	updater.params.progress = func() {}
+	updater.params.newFiles = func() {}
+
+	return &updater
+}
+
+// Remove removes items with the paths, items of removed folders are removed with them.
+func (index *Index) Remove(paths ...RelativePath) error {
+	index.updating.Lock()
+	defer index.updating.Unlock()
+
+	index.mu.Lock()
+	defer index.mu.Unlock()
+
+	for _, path := range paths {
+		if m, ok := index.paths[path]; ok {
+			index.drop(m)
+			index.outDated = true
+		}
+	}
+
+	return index.compactData()
+}
+
+func (index *Index) exists(path RelativePath) bool {
+	_, err := os.Lstat(filepath.Join(index.root, string(path)))
+
+	return err == nil
+}
@@ -0,0 +1,103 @@
+package index
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestIndexUpdate(t *testing.T) {
+	t.Parallel()
+	require := require.New(t)
+
+	modTime := time.Date(2024, 11, 5, 5, 5, 5, 0, time.UTC)
+	newFile := func(path string, dir bool) FileMeta {
+		return &mockFile{relativePath: path, name: path, dir: dir, modTime: modTime}
+	}
+
+	sampleData := make([]byte, 10)
+	index, err := NewIndex(
+		context.Background(),
+		nil,
+		WithFiles([]FileMeta{newFile("a", true), newFile("a/b.jpg", false)}),
+		WithPreview(mockPreviewGenerator{sampleData: sampleData}),
+		WithWorkers(2),
+	)
+	require.NoError(err)
+
+	// the index is read by the server while it's updated
+	dirID := index.paths["a"].ID
+	wg := sync.WaitGroup{}
+	wg.Add(1)
+
+	go func() {
+		defer wg.Done()
+
+		for range 100 {
+			_, _ = index.PullChildren(dirID)
+			_ = index.Search("b", "")
+		}
+	}()
+
+	require.NoError(index.Update(context.Background(), []FileMeta{
+		newFile("a/c", true),
+		newFile("a/c/d.jpg", false),
+		newFile("e.jpg", false),
+	}))
+	wg.Wait()
+
+	require.Len(index.meta, 5)
+	require.Len(index.data, 3*len(sampleData))
+	require.Len(index.tree[rootID], 2)
+
+	children, err := index.PullChildren(index.paths["a"].ID)
+	require.NoError(err)
+	require.Len(children, 2)
+
+	children, err = index.PullChildren(index.paths["a/c"].ID)
+	require.NoError(err)
+	require.Len(children, 1)
+
+	// the folder is removed with its content, previews of the removed items are dropped
+	require.NoError(index.Remove("a/c"))
+	require.Len(index.meta, 3)
+	require.Nil(index.paths["a/c/d.jpg"])
+	require.Len(index.data, 2*len(sampleData))
+
+	children, err = index.PullChildren(index.paths["a"].ID)
+	require.NoError(err)
+	require.Len(children, 1)
+
+	preview, err := index.PullPreview(index.paths["e.jpg"].ID)
+	require.NoError(err)
+	require.Equal(sampleData, preview)
+}
+
+func TestIndexRescan(t *testing.T) {
+	t.Parallel()
+	require := require.New(t)
+
+	modTime := time.Date(2024, 11, 5, 5, 5, 5, 0, time.UTC)
+	newFile := func(path string) FileMeta {
+		return &mockFile{relativePath: path, name: path, modTime: modTime}
+	}
+
+	sampleData := make([]byte, 10)
+	index, err := NewIndex(
+		context.Background(),
+		nil,
+		WithFiles([]FileMeta{newFile("a.jpg"), newFile("b.jpg")}),
+		WithPreview(mockPreviewGenerator{sampleData: sampleData}),
+	)
+	require.NoError(err)
+
+	// the new file is loaded, the missing one is removed with its preview
+	require.NoError(index.Rescan(context.Background(), []FileMeta{newFile("a.jpg"), newFile("c.jpg")}))
+	require.Len(index.meta, 2)
+	require.NotNil(index.paths["c.jpg"])
+	require.Nil(index.paths["b.jpg"])
+	require.Len(index.data, 2*len(sampleData))
+}
@@ -0,0 +1,89 @@
+package index
+
+import (
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"log/slog"
+	"math"
+)
+
+// Index file format versions. Files created before the versioning
+// have no version in the header, they are treated as legacyVersion.
+const (
+	legacyVersion uint32 = iota + 1
+	currentVersion
+)
+
+// versionMarker takes place of the meta items count in the legacy header,
+// it tells versioned files apart from legacy ones.
+const versionMarker = math.MaxUint32
+
+var (
+	ErrUnsupportedVersion = errors.New("unsupported index file version")
+	ErrInvalidVersion     = errors.New("invalid index file version")
+	ErrMigration          = errors.New("failed to migrate index")
+)
+
+type migration func(index *Index) error
+
+// migrations upgrade the decoded index from the version (key) to the next one.
+func migrations() map[uint32]migration {
+	return map[uint32]migration{
+		// previews have got checksums, absolute paths aren't stored anymore, they are dropped by the next save
+		legacyVersion: func(index *Index) error {
+			for _, m := range index.meta {
+				if m.Preview.Length == 0 {
+					continue
+				}
+
+				data, err := index.readPreview(m.Preview)
+				if err != nil {
+					return err
+				}
+
+				m.Preview.Checksum = crc32.ChecksumIEEE(data)
+			}
+
+			return nil
+		},
+	}
+}
+
+func checkVersion(version uint32) error {
+	// versions start from legacyVersion, so the lower one can only be read from a damaged file
+	if version < legacyVersion {
+		return fmt.Errorf("%w: %d, the index file is corrupted", ErrInvalidVersion, version)
+	}
+
+	if version > currentVersion {
+		return fmt.Errorf(
+			"%w: %d (the latest supported is %d), the index file was created by a newer TinyTune",
+			ErrUnsupportedVersion,
+			version,
+			currentVersion,
+		)
+	}
+
+	return nil
+}
+
+func (index *Index) migrate(version uint32) error {
+	if version == 0 || version == currentVersion {
+		return nil
+	}
+
+	for v := version; v < currentVersion; v++ {
+		if m, ok := migrations()[v]; ok {
+			if err := m(index); err != nil {
+				return fmt.Errorf("%w from version %d: %w", ErrMigration, v, err)
+			}
+		}
+	}
+
+	slog.Info("Index file migrated", slog.Int("from", int(version)), slog.Int("to", int(currentVersion)))
+
+	index.outDated = true
+
+	return nil
+}
@@ -4,6 +4,18 @@ import (
 	"time"
 )
 
+// Probe is media information of the file, which is collected without producing its preview.
+type Probe interface {
+	Duration() time.Duration
+	Resolution() (int, int)
+	Codec() string
+}
+
+// ProbedSource is the source, which media information is probed already, so it isn't probed again by Pull.
+type ProbedSource interface {
+	Probed() (Probe, bool)
+}
+
 type Data interface {
 	Data() []byte
 	Duration() time.Duration
@@ -14,6 +26,7 @@ type data struct {
 	duration time.Duration
 	width    int
 	height   int
+	codec    string
 	data     []byte
 }
 
@@ -25,6 +38,10 @@ func (d data) Resolution() (int, int) {
 	return d.width, d.height
 }
 
+func (d data) Codec() string {
+	return d.codec
+}
+
 func (d data) Data() []byte {
 	return d.data
 }
@@ -37,7 +37,7 @@ type probeStream struct {
 	Height       int    `json:"height"`
 	AvgFrameRate string `json:"avg_frame_rate"` //nolint:tagliatelle
 	CodecType    string `json:"codec_type"`     //nolint:tagliatelle
-	CodecName    string `json:"codec_nae"`      //nolint:tagliatelle
+	CodecName    string `json:"codec_name"`     //nolint:tagliatelle
 }
 
 type probeData struct {
@@ -3,8 +3,10 @@ package preview
 import (
 	"bytes"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 )
 
 func TestFormatCodecs(t *testing.T) {
@@ -27,3 +29,19 @@ func TestFormatCodecs(t *testing.T) {
 	//nolint:lll
 	assert.Equal(t, []string{"av1", "h264", "hevc", "mjpeg", "mpeg1video", "mpeg2video", "mpeg4", "vc1", "vp8", "vp9"}, result)
 }
+
+func TestProbeOutputFrames(t *testing.T) {
+	t.Parallel()
+
+	sampleOutput := `{
+	"streams": [
+		{"codec_type": "audio", "codec_name": "aac"},
+		{"codec_type": "video", "codec_name": "h264", "width": 1920, "height": 1080, "avg_frame_rate": "30/1"}
+	],
+	"format": {"duration": "62.500000"}
+}`
+
+	output, err := probeOutputFrames(sampleOutput)
+	require.NoError(t, err)
+	assert.Equal(t, probeOutput{width: 1920, height: 1080, duration: 62 * time.Second, codec: "h264"}, output)
+}
@@ -3,9 +3,18 @@ package preview
 import (
 	"errors"
 	"fmt"
+	"image"
+	"os"
 	"strings"
 
 	"github.com/davidbyttow/govips/v2/vips"
+
+	// decoders of the image formats, for reading their resolution
+	_ "golang.org/x/image/bmp"
+	_ "golang.org/x/image/webp"
+	_ "image/gif"
+	_ "image/jpeg"
+	_ "image/png"
 )
 
 const (
@@ -15,6 +24,7 @@ const (
 var (
 	ErrVipsLoadImage = errors.New("failed load image")
 	ErrImageExport   = errors.New("failed export the image")
+	ErrImageDecode   = errors.New("failed to decode the image header")
 )
 
 func imagePreview(path string) (data, error) {
@@ -32,6 +42,27 @@ func imagePreview(path string) (data, error) {
 	return preview, err
 }
 
+// imageInfo reads the resolution and format of the image from its header.
+func imageInfo(path string) (data, error) {
+	info := data{}
+
+	file, err := os.Open(path)
+	if err != nil {
+		return info, fmt.Errorf("%w: %w", ErrImageDecode, err)
+	}
+	defer file.Close()
+
+	config, format, err := image.DecodeConfig(file)
+	if err != nil {
+		return info, fmt.Errorf("%w: %w", ErrImageDecode, err)
+	}
+
+	info.width, info.height = config.Width, config.Height
+	info.codec = format
+
+	return info, nil
+}
+
 func exportWebP(image *vips.ImageRef) ([]byte, error) {
 	ep := vips.NewWebpExportParams()
 
@@ -3,6 +3,10 @@ package preview
 import (
 	"crypto/sha256"
 	"encoding/hex"
+	"image"
+	"image/png"
+	"os"
+	"path/filepath"
 	"testing"
 
 	"github.com/stretchr/testify/assert"
@@ -56,3 +60,25 @@ func TestPreviewImage(t *testing.T) {
 		})
 	}
 }
+
+func TestImageInfo(t *testing.T) {
+	t.Parallel()
+	require := require.New(t)
+
+	path := filepath.Join(t.TempDir(), "image.png")
+	file, err := os.Create(path)
+	require.NoError(err)
+	require.NoError(png.Encode(file, image.NewRGBA(image.Rect(0, 0, 640, 480))))
+	require.NoError(file.Close())
+
+	info, err := imageInfo(path)
+	require.NoError(err)
+
+	width, height := info.Resolution()
+	require.Equal(640, width)
+	require.Equal(480, height)
+	require.Equal("png", info.Codec())
+
+	_, err = imageInfo(filepath.Join(t.TempDir(), "missing.png"))
+	require.ErrorIs(err, ErrImageDecode)
+}
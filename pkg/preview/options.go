@@ -22,13 +22,6 @@ func WithVideoAccel(param VideoProcessingAccelType) Option {
 	}
 }
 
-// files = map[FilePath]struct{}.
-func WithExcludedFiles(files map[string]struct{}) Option {
-	return func(p *Previewer) {
-		p.excludedFiles = files
-	}
-}
-
 func WithMaxImages(param int64) Option {
 	return func(p *Previewer) {
 		p.maxImages = param
@@ -52,3 +45,12 @@ func WithTimeout(param time.Duration) Option {
 		p.timeout = param
 	}
 }
+
+// WithSettings makes the processing settings of each file be resolved by the function, e.g. by its folder.
+// Otherwise the ones given by WithImage, WithVideo and WithMaxFileSize are used, video processing can't be
+// turned on by the function, if it's turned off by WithVideo.
+func WithSettings(settings func(src Source) Settings) Option {
+	return func(p *Previewer) {
+		p.settings = settings
+	}
+}
@@ -18,11 +18,15 @@ const (
 	BigVideoSizeB                      = 500 * 1024 * 1024
 	BigVideoThrottleMaxOccupiedPercent = 0.9
 	BigVideoThrottleMaxWaiting         = time.Duration(5) * time.Second
+	defaultVideoWidth                  = 1280
+	defaultVideoHeight                 = 720
 )
 
 var (
 	ErrVideoPreview               = errors.New("failed create preview for video")
 	ErrImagePreview               = errors.New("failed create preview for image")
+	ErrVideoProbe                 = errors.New("failed probe video")
+	ErrImageProbe                 = errors.New("failed probe image")
 	ErrFFmpegCudaDecodersNotFound = errors.New("cuda decoders not found in ffmpeg")
 	ErrFFmpegCudaProbe            = errors.New("failed probe cuda decoders in ffmpeg")
 )
@@ -35,12 +39,21 @@ type Source interface {
 	Size() int64
 }
 
+// Settings are the processing settings of a single file.
+type Settings struct {
+	Image       bool
+	Video       bool
+	MaxFileSize int64
+	// Excluded turns off processing of the file, e.g. it matches exclude patterns
+	Excluded bool
+}
+
 type Previewer struct {
+	settings       func(src Source) Settings
 	image          bool
 	video          bool
 	maxImages      int64
 	maxVideos      int64
-	excludedFiles  map[string]struct{}
 	videoParams    VideoParams
 	videoAccelType VideoProcessingAccelType
 	bigVideoQueue  chan struct{}
@@ -75,7 +88,6 @@ func NewPreviewer(opts ...Option) (*Previewer, error) {
 	preview := &Previewer{
 		maxImages:      -1,
 		maxVideos:      -1,
-		excludedFiles:  map[string]struct{}{},
 		image:          true,
 		video:          true,
 		maxFileSize:    -1,
@@ -87,6 +99,10 @@ func NewPreviewer(opts ...Option) (*Previewer, error) {
 		opt(preview)
 	}
 
+	if preview.settings == nil {
+		preview.settings = preview.defaultSettings
+	}
+
 	if preview.video {
 		videoParams, err := videoInit(preview.videoAccelType)
 		if err != nil {
@@ -152,13 +168,50 @@ func ifMaxPass(maxNewItems *int64) bool {
 	return true
 }
 
+// Probe returns media information of the file, it's fast comparing to producing the preview by Pull.
+// Files, which aren't processed by the settings, aren't probed.
+//
+//nolint:ireturn
+func (p Previewer) Probe(ctx context.Context, src Source) (Probe, error) {
+	settings := p.settings(src)
+	skipped := settings.Excluded || (settings.MaxFileSize != -1 && src.Size() > settings.MaxFileSize)
+
+	switch {
+	case src.IsImage() && settings.Image && !skipped:
+		info, err := imageInfo(src.Path())
+		if err != nil {
+			return info, fmt.Errorf("%w: %w", ErrImageProbe, err)
+		}
+
+		return info, nil
+	case src.IsVideo() && p.video && settings.Video && !skipped:
+		info, err := videoInfo(ctx, src.Path(), p.videoParams.timeout)
+		if err != nil {
+			return info, fmt.Errorf("%w: %w", ErrVideoProbe, err)
+		}
+
+		return info, nil
+	case src.IsVideo():
+		// default resolution for video player
+		return data{width: defaultVideoWidth, height: defaultVideoHeight}, nil
+	}
+
+	return data{}, nil
+}
+
+func (p Previewer) defaultSettings(Source) Settings {
+	return Settings{Image: p.image, Video: p.video, MaxFileSize: p.maxFileSize}
+}
+
 //nolint:cyclop,ireturn,nolintlint
 func (p Previewer) Pull(ctx context.Context, src Source) (Data, error) {
 	defaultPreview := data{}
+	settings := p.settings(src)
 
-	biggestThenMaxFileSize := p.maxFileSize != -1 && src.Size() > p.maxFileSize
-	toImage := src.IsImage() && p.image && ifMaxPass(&p.maxImages)
-	toVideo := src.IsVideo() && p.video && ifMaxPass(&p.maxVideos)
+	biggestThenMaxFileSize := settings.MaxFileSize != -1 && src.Size() > settings.MaxFileSize
+	toImage := !settings.Excluded && src.IsImage() && settings.Image && ifMaxPass(&p.maxImages)
+	// videos aren't processed without the initialized ffmpeg
+	toVideo := !settings.Excluded && src.IsVideo() && p.video && settings.Video && ifMaxPass(&p.maxVideos)
 
 	if biggestThenMaxFileSize {
 		return defaultPreview, nil
@@ -194,7 +247,7 @@ func (p Previewer) Pull(ctx context.Context, src Source) (Data, error) {
 		})
 		defer timer.Stop()
 
-		preview, err := videoPreview(ctx, src.Path(), p.videoParams)
+		preview, err := videoPreview(ctx, src.Path(), p.videoParams, sourceProbe(src))
 		if err != nil || preview.Duration() == 0 {
 			return defaultPreview, fmt.Errorf("%w: %w", ErrVideoPreview, err)
 		}
@@ -204,13 +257,26 @@ func (p Previewer) Pull(ctx context.Context, src Source) (Data, error) {
 
 	if src.IsVideo() {
 		// default resolution for video player
-		defaultPreview.width = 1280
-		defaultPreview.height = 720
+		defaultPreview.width = defaultVideoWidth
+		defaultPreview.height = defaultVideoHeight
 	}
 
 	return defaultPreview, nil
 }
 
+// sourceProbe returns the media information, which is probed already, nil if the source hasn't got it.
+//
+//nolint:ireturn
+func sourceProbe(src Source) Probe {
+	if probed, ok := src.(ProbedSource); ok {
+		if probe, ok := probed.Probed(); ok {
+			return probe
+		}
+	}
+
+	return nil
+}
+
 func (p Previewer) Close() {
 	vips.Shutdown()
 }
@@ -81,3 +81,32 @@ func TestPreview(t *testing.T) {
 		})
 	}
 }
+
+func TestPreviewProbeSettings(t *testing.T) {
+	t.Parallel()
+	require := require.New(t)
+
+	// the missing files fail to be probed, unless they are skipped by the settings
+	image := mockSource{image: true, path: "missing.jpg", size: 10}
+	video := mockSource{video: true, path: "missing.mp4", size: 10}
+
+	for _, settings := range []Settings{
+		{Image: false, Video: false, MaxFileSize: -1},
+		{Image: true, Video: true, MaxFileSize: -1, Excluded: true},
+		{Image: true, Video: true, MaxFileSize: 5},
+	} {
+		previewer := Previewer{video: true, settings: func(Source) Settings { return settings }}
+
+		probe, err := previewer.Probe(context.Background(), image)
+		require.NoError(err)
+		require.Equal(data{}, probe)
+
+		probe, err = previewer.Probe(context.Background(), video)
+		require.NoError(err)
+		require.Equal(data{width: defaultVideoWidth, height: defaultVideoHeight}, probe)
+	}
+
+	previewer := Previewer{video: true, settings: func(Source) Settings { return Settings{Image: true, MaxFileSize: -1} }}
+	_, err := previewer.Probe(context.Background(), image)
+	require.ErrorIs(err, ErrImageProbe)
+}
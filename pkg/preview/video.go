@@ -129,31 +129,54 @@ func produceVideoPreview(ctx context.Context, path string, duration time.Duratio
 	return data, nil
 }
 
-func videoPreview(ctx context.Context, path string, params VideoParams) (data, error) {
-	preview := data{}
+// videoInfo probes the video for its resolution, duration and codec.
+func videoInfo(ctx context.Context, path string, timeout time.Duration) (data, error) {
+	info := data{}
 
-	metaJSON, err := videoProbe(ctx, path, params.timeout)
+	metaJSON, err := videoProbe(ctx, path, timeout)
 	if err != nil {
-		return preview, err
+		return info, err
 	}
 
 	output, err := probeOutputFrames(metaJSON)
 	if err != nil {
-		return preview, err
+		return info, err
 	}
 
-	preview.width = output.width
-	preview.height = output.height
-	preview.duration = output.duration
+	info.width = output.width
+	info.height = output.height
+	info.duration = output.duration
+	info.codec = output.codec
+
+	return info, nil
+}
+
+// videoPreview produces the preview of the video, it's probed, unless the probe is given.
+func videoPreview(ctx context.Context, path string, params VideoParams, probe Probe) (data, error) {
+	preview, err := probedInfo(ctx, path, params.timeout, probe)
+	if err != nil {
+		return preview, err
+	}
 
 	// switch unsupported codecs to software processing
-	if len(params.accelSupportedCodecs) != 0 && !slices.Contains(params.accelSupportedCodecs, output.codec) {
+	if len(params.accelSupportedCodecs) != 0 && !slices.Contains(params.accelSupportedCodecs, preview.codec) {
 		params.accel = ffmpegSoftwareAccel
 	}
 
-	if preview.data, err = produceVideoPreview(ctx, path, output.duration, params); err != nil {
+	if preview.data, err = produceVideoPreview(ctx, path, preview.duration, params); err != nil {
 		return preview, err
 	}
 
 	return preview, nil
 }
+
+// probedInfo returns the media information of the video from the probe, the video is probed without it.
+func probedInfo(ctx context.Context, path string, timeout time.Duration, probe Probe) (data, error) {
+	if probe == nil {
+		return videoInfo(ctx, path, timeout)
+	}
+
+	width, height := probe.Resolution()
+
+	return data{duration: probe.Duration(), width: width, height: height, codec: probe.Codec()}, nil
+}
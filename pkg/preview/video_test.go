@@ -62,7 +62,7 @@ func TestPreviewVideo(t *testing.T) {
 			t.Parallel()
 
 			require := require.New(t)
-			preview, err := videoPreview(context.Background(), testCase.SourcePath, VideoParams{timeout: time.Minute})
+			preview, err := videoPreview(context.Background(), testCase.SourcePath, VideoParams{timeout: time.Minute}, nil)
 			require.NoError(err)
 			require.Len(
 				preview.Data(),
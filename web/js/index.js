@@ -48,6 +48,10 @@ const onPopState = () => {
 
 window.onload = () => {
     window.addEventListener('popstate', onPopState)
+    // new thumbnails are shown while the files are processed
+    document.body.addEventListener('indexed', () => {
+        htmx.ajax('GET', window.location.pathname + window.location.search, { target: '#content', select: '#content', swap: 'outerHTML' })
+    })
     document.addEventListener('htmx:afterSettle', () => {
         initLightBox();
         gifInit();